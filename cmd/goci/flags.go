@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultWaitTimeout       = 30 * time.Minute
+	defaultDeployConcurrency = 4
+)
+
+// options are the flags which may follow the mode on the command line.
+type options struct {
+	// env overrides the environment every app is deployed to.
+	env string
+	// strategy overrides the catapult deployment strategy of every app.
+	strategy string
+	// wait blocks until every deploy finishes, failing if any deploy
+	// fails or waitTimeout passes.
+	wait        bool
+	waitTimeout time.Duration
+	// concurrency is the maximum number of deploys run at once.
+	concurrency int
+	// keepGoing continues deploying the remaining apps after a deploy
+	// fails.
+	keepGoing bool
+	// write rewrites catalog-info.yaml in catalog mode instead of only
+	// reporting drift.
+	write bool
+	// args are the positional arguments, which may be mixed with the
+	// flags.
+	args []string
+}
+
+// modeArgs is the maximum number of positional arguments each mode
+// accepts.
+var modeArgs = map[string]int{
+	"validate-catalog": 1,
+	"rollback":         1,
+}
+
+func parseOptions(mode string, args []string) (options, error) {
+	var o options
+	fs := flag.NewFlagSet("goci "+mode, flag.ContinueOnError)
+	fs.StringVar(&o.env, "env", "", "environment to deploy apps to, overriding config/<app>/stack.yaml")
+	fs.StringVar(&o.strategy, "strategy", "", "catapult deployment strategy (confirm-then-deploy or no-confirm-deploy), overriding config/<app>/stack.yaml")
+	fs.BoolVar(&o.wait, "wait", false, "wait for deploys to finish and fail if any deploy fails")
+	fs.DurationVar(&o.waitTimeout, "wait-timeout", defaultWaitTimeout, "how long to wait for deploys to finish")
+	fs.IntVar(&o.concurrency, "concurrency", defaultDeployConcurrency, "maximum number of deploys to run at once")
+	fs.BoolVar(&o.keepGoing, "keep-going", false, "keep deploying the remaining apps after a deploy fails")
+	fs.BoolVar(&o.write, "write", false, "rewrite catalog-info.yaml from the launch configs instead of reporting drift")
+	// Flags may come before or after positional arguments, as in
+	// goci rollback <app> --env production.
+	for {
+		if err := fs.Parse(args); err != nil {
+			return o, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		o.args = append(o.args, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(o.args) > modeArgs[mode] {
+		return o, fmt.Errorf("unexpected arguments %v. %s", o.args[modeArgs[mode]:], usage)
+	}
+	return o, nil
+}
@@ -2,26 +2,40 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/Clever/catapult/gen-go/models"
 	"github.com/Clever/ci-scripts/internal/backstage"
-	"github.com/Clever/ci-scripts/internal/catalogsync"
 	"github.com/Clever/ci-scripts/internal/catapult"
+	"github.com/Clever/ci-scripts/internal/deploy"
 	"github.com/Clever/ci-scripts/internal/docker"
 	"github.com/Clever/ci-scripts/internal/environment"
+	"github.com/Clever/ci-scripts/internal/integrations"
 	"github.com/Clever/ci-scripts/internal/lambda"
+	"github.com/Clever/ci-scripts/internal/manifest"
 	"github.com/Clever/ci-scripts/internal/platformevents"
 	"github.com/Clever/ci-scripts/internal/repo"
+	"github.com/Clever/ci-scripts/internal/spark"
+	"github.com/Clever/ci-scripts/internal/static"
 	ciIntegrationsModels "github.com/Clever/circle-ci-integrations/gen-go/models"
 )
 
-const usage = "usage: goci <validate|detect|artifact-build-publish-deploy|publish-utility|deploy-apps>"
+const usage = "usage: goci <validate|validate-catalog [path]|detect|artifact-build-publish-deploy|publish-utility|deploy-apps|rollback <app>|catalog> [--env <environment>] [--strategy <strategy>] [--wait] [--wait-timeout <duration>] [--concurrency <n>] [--keep-going] [--write]"
+
+const defaultCatalogInfoPath = "./catalog-info.yaml"
+
+// deployStatusInterval is how often deploy status is polled when waiting
+// for deploys to finish.
+const deployStatusInterval = 15 * time.Second
 
 // This app assumes the code has been checked out and that the
 // repository is the working directory.
@@ -41,7 +55,12 @@ func main() {
 		os.Exit(1)
 	}
 	mode := os.Args[1]
-	if err := run(mode); err != nil {
+	opts, err := parseOptions(mode, os.Args[2:])
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if err := run(mode, opts); err != nil {
 		if _, ok := err.(*ValidationError); ok {
 			fmt.Println("Validation error:", err)
 			os.Exit(2) // Use a different exit code for validation errors
@@ -52,7 +71,7 @@ func main() {
 	}
 }
 
-func run(mode string) error {
+func run(mode string, opts options) error {
 	var apps map[string]*models.LaunchConfig
 	var appIDs []string
 	var err error
@@ -72,7 +91,17 @@ func run(mode string) error {
 	switch mode {
 	case "publish-utility":
 		return publishUtility()
+	case "validate-catalog":
+		path := defaultCatalogInfoPath
+		if len(opts.args) > 0 {
+			path = opts.args[0]
+		}
+		_, err := validateCatalog(path)
+		return err
 	case "validate":
+		if err := lintStacks(); err != nil {
+			return err
+		}
 		err := validateRun()
 		if err != nil {
 			return err
@@ -82,7 +111,11 @@ func run(mode string) error {
 		fmt.Println(strings.Join(appIDs, " "))
 		return nil
 	case "deploy-apps":
-		return deployApps(appIDs)
+		return deployApps(appIDs, opts)
+	case "rollback":
+		return rollback(opts)
+	case "catalog":
+		return reconcileCatalog(opts.write)
 	case "artifact-build-publish-deploy":
 		// continue
 	default:
@@ -95,17 +128,66 @@ func run(mode string) error {
 		return nil
 	}
 
+	ctx := context.Background()
+	events, err := platformevents.NewLifecycle(ctx)
+	if err != nil {
+		return err
+	}
+	events.BuildStarted(ctx, appIDs)
+	err = buildPublishDeploy(ctx, apps, appIDs, opts, events)
+	events.BuildFinished(ctx, appIDs, err)
+	return err
+}
+
+// buildPublishDeploy builds and publishes the artifacts of the apps, and
+// deploys them on master, publishing a lifecycle event for each artifact
+// and catalog sync.
+func buildPublishDeploy(ctx context.Context, apps map[string]*models.LaunchConfig, appIDs []string, opts options, events *platformevents.Lifecycle) error {
 	var (
-		ctx       = context.Background()
-		artifacts []*catapult.Artifact
+		artifacts     []*catapult.Artifact
+		buildManifest = &manifest.Manifest{}
+		deployTargets []deploy.Target
+		runner        deploy.Runner
 	)
 
+	syncs, err := integrations.NewSyncReport(environment.CatalogSyncPolicy())
+	if err != nil {
+		return err
+	}
+
+	// Resolve deploy targets before building anything so that invalid
+	// deploy configuration fails fast.
+	if environment.Branch() == "master" {
+		if deployTargets, err = catapultDeployTargets(appIDs, opts); err != nil {
+			return err
+		}
+		if runner, err = deployRunner(opts); err != nil {
+			return err
+		}
+		if _, err = deploy.Waves(deployTargets, runner.DeployAfter); err != nil {
+			return err
+		}
+	}
+
 	dockerTargets, dockerArtifacts := docker.BuildTargets(apps)
-	lambdaTargets, lambdaArtifacts := lambda.BuildTargets(apps)
+	lambdaTargets, lambdaArtifacts, err := lambda.BuildTargets(apps)
+	if err != nil {
+		return err
+	}
+	layerTargets, err := lambda.LayerTargets(apps)
+	if err != nil {
+		return err
+	}
+	sparkTargets, sparkArtifacts := spark.BuildTargets(apps)
+	staticTargets, err := static.BuildTargets(apps)
+	if err != nil {
+		return err
+	}
 	artifacts = append(artifacts, dockerArtifacts...)
 	artifacts = append(artifacts, lambdaArtifacts...)
-	// We don't handle all application types yet (e.g. spark), so error out
-	// instead of silently not building everything.
+	artifacts = append(artifacts, sparkArtifacts...)
+	// We don't handle every possible run type, so error out instead of
+	// silently not building everything.
 	if err = allAppsBuilt(apps, artifacts); err != nil {
 		return err
 	}
@@ -117,6 +199,7 @@ func run(mode string) error {
 		}
 
 		for dockerfile, t := range dockerTargets {
+			start := time.Now()
 			if err = repo.ExecBuild(t.Command); err != nil {
 				return err
 			}
@@ -124,41 +207,167 @@ func run(mode string) error {
 			if err = dkr.Build(ctx, ".", dockerfile, t.Tags); err != nil {
 				return err
 			}
-			if err = dkr.Push(ctx, t.Tags); err != nil {
+			a := platformevents.Artifact{Name: t.Artifact, Type: platformevents.ArtifactDocker, Reference: t.Tags[0]}
+			events.ArtifactBuilt(ctx, a, time.Since(start))
+
+			start = time.Now()
+			if a.Digest, err = dkr.Push(ctx, t.Tags); err != nil {
 				return err
 			}
+			events.ArtifactPublished(ctx, a, time.Since(start))
 		}
 	}
 
-	if len(lambdaTargets) > 0 {
-		lmda := lambda.New(ctx, environment.LambdaArtifactBucketPrefix())
+	if len(lambdaTargets) > 0 || len(layerTargets) > 0 {
+		lmda := lambda.New(ctx)
+
+		// Layers are published first so that they are available to any
+		// functions referencing them.
+		for name, t := range layerTargets {
+			start := time.Now()
+			if err = repo.ExecBuild(t.Command); err != nil {
+				return err
+			}
+			a, err := lambdaArtifact(name, platformevents.ArtifactLayer, t.Zip, "")
+			if err != nil {
+				return err
+			}
+			events.ArtifactBuilt(ctx, a, time.Since(start))
+
+			start = time.Now()
+			versions, err := lmda.PublishLayer(ctx, name, t)
+			if err != nil {
+				return err
+			}
+			buildManifest.Layers = append(buildManifest.Layers, versions...)
+			if len(versions) > 0 {
+				a.Reference = fmt.Sprintf("s3://%s/%s", versions[0].S3Bucket, versions[0].S3Key)
+				if versions[0].Arn != "" {
+					a.Reference = versions[0].Arn
+				}
+			}
+			events.ArtifactPublished(ctx, a, time.Since(start))
+		}
 
 		for artifact, t := range lambdaTargets {
+			start := time.Now()
 			if err = repo.ExecBuild(t.Command); err != nil {
 				return err
 			}
+			a, err := lambdaArtifact(artifact, platformevents.ArtifactLambda, t.Zip, lambda.ArtifactURI(artifact, t.Buckets))
+			if err != nil {
+				return err
+			}
+			events.ArtifactBuilt(ctx, a, time.Since(start))
 
-			if err = lmda.Publish(ctx, t.Zip, artifact); err != nil {
+			start = time.Now()
+			if err = lmda.Publish(ctx, t.Zip, artifact, t.Buckets); err != nil {
 				return err
 			}
+			events.ArtifactPublished(ctx, a, time.Since(start))
 		}
 	}
-	cp := catapult.New()
+	if len(sparkTargets) > 0 {
+		spk := spark.New(ctx)
+
+		for artifact, t := range sparkTargets {
+			start := time.Now()
+			if err = repo.ExecBuild(t.Command); err != nil {
+				return err
+			}
+			a := platformevents.Artifact{Name: artifact, Type: platformevents.ArtifactSpark, Reference: spark.ArtifactURI(artifact)}
+			events.ArtifactBuilt(ctx, a, time.Since(start))
 
-	if err = cp.Publish(ctx, artifacts); err != nil {
+			start = time.Now()
+			if err = spk.Publish(ctx, t.Dir, artifact); err != nil {
+				return err
+			}
+			events.ArtifactPublished(ctx, a, time.Since(start))
+		}
+	}
+
+	// Static files are built by each application's build command, so
+	// they are uploaded after all other artifacts are built.
+	if len(staticTargets) > 0 {
+		stc := static.New(ctx)
+
+		for app, t := range staticTargets {
+			start := time.Now()
+			if err = stc.Publish(ctx, t); err != nil {
+				return fmt.Errorf("failed to publish static files for %s: %v", app, err)
+			}
+			events.ArtifactPublished(ctx, platformevents.Artifact{
+				Name:      app,
+				Type:      platformevents.ArtifactStatic,
+				Reference: fmt.Sprintf("s3://%s/%s", t.Bucket, t.Prefix),
+			}, time.Since(start))
+		}
+	}
+
+	if len(buildManifest.Layers) > 0 {
+		if err = buildManifest.Write(environment.ManifestPath()); err != nil {
+			return err
+		}
+	}
+
+	ci, err := integrations.NewFromEnv()
+	if err != nil {
+		return err
+	}
+	ci.OnSync = events.CatalogSynced
+	cp := catapult.New(ci)
+
+	if err = cp.Publish(ctx, artifacts, syncs); err != nil {
 		return err
 	}
 
 	if environment.Branch() == "master" {
-		if err := cp.Deploy(ctx, appIDs); err != nil {
+		summary, err := runner.Run(ctx, deployTargets, cp.Deploy)
+		if err != nil {
 			return err
 		}
+		if err := errors.Join(finishDeploys(summary), syncs.Finish()); err != nil {
+			return err
+		}
+	} else if err := syncs.Finish(); err != nil {
+		return err
 	}
 
 	// We want to validate on every run, not just when the mode is "validate".
 	return validateRun()
 }
 
+// lambdaArtifact references a built lambda archive in artifact events.
+func lambdaArtifact(name, artifactType, zip, reference string) (platformevents.Artifact, error) {
+	digest, err := lambda.ArchiveDigest(zip)
+	if err != nil {
+		return platformevents.Artifact{}, err
+	}
+	if reference == "" {
+		reference = zip
+	}
+	return platformevents.Artifact{Name: name, Type: artifactType, Reference: reference, Digest: digest}, nil
+}
+
+// lintStacks reports every problem in the stack configs of the repo,
+// failing validation if any are errors.
+func lintStacks() error {
+	lint, err := repo.LintStacks(environment.KnownEnvironments())
+	if err != nil {
+		return err
+	}
+	for _, w := range lint.Warnings {
+		fmt.Println("warning:", w)
+	}
+	for _, e := range lint.Errors {
+		fmt.Println("error:", e)
+	}
+	if len(lint.Errors) > 0 {
+		return &ValidationError{Message: fmt.Sprintf("%d problems found in stack configs", len(lint.Errors))}
+	}
+	return nil
+}
+
 // validateRun checks the env.branch and go version to ensure the build is valid.
 func validateRun() error {
 	if strings.Contains(environment.Branch(), "/") {
@@ -275,32 +484,221 @@ func allAppsBuilt(discoveredApps map[string]*models.LaunchConfig, builtApps []*c
 	return fmt.Errorf("applications %s not built", strings.Join(missing, ", "))
 }
 
+// validateCatalog reports every problem in the catalog entity file and
+// the local files its Location entities point to, returning a validation
+// error if there are any. The catalog entities are returned if they are
+// all valid.
+func validateCatalog(path string) ([]*backstage.Entity, error) {
+	problems, err := validateCatalogFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if problems > 0 {
+		return nil, &ValidationError{Message: fmt.Sprintf("%s has %d problems", path, problems)}
+	}
+	entities, err := backstage.LoadCatalog(path)
+	if err != nil {
+		return nil, err
+	}
+
+	validated := map[string]bool{filepath.Clean(path): true}
+	for _, e := range entities {
+		if validated[e.File] {
+			continue
+		}
+		validated[e.File] = true
+		n, err := validateCatalogFile(e.File)
+		if err != nil {
+			return nil, err
+		}
+		problems += n
+	}
+	if problems > 0 {
+		return nil, &ValidationError{Message: fmt.Sprintf("catalog has %d problems", problems)}
+	}
+	fmt.Println(path, "is valid")
+	return entities, nil
+}
+
+// validateCatalogFile prints every problem in a single catalog file and
+// returns how many there were, not counting warnings.
+func validateCatalogFile(path string) (int, error) {
+	problems, err := backstage.ValidateFile(path)
+	if err != nil {
+		return 0, err
+	}
+	errs := 0
+	for _, p := range problems {
+		fmt.Printf("%s:%s\n", path, p)
+		if !p.Warning {
+			errs++
+		}
+	}
+	return errs, nil
+}
+
+// reconcileCatalog generates a Component for every application in the
+// repo, regardless of changes, and compares them with catalog-info.yaml.
+// Drift is reported as a validation error unless write is set, in which
+// case the file is rewritten.
+func reconcileCatalog(write bool) error {
+	apps, err := repo.DiscoverAllApplications("./launch")
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(apps))
+	for app := range apps {
+		names = append(names, app)
+	}
+	sort.Strings(names)
+
+	components := []*backstage.Entity{}
+	for _, app := range names {
+		team, err := repo.Team(app)
+		if err != nil {
+			return err
+		}
+		c, err := backstage.NewComponent(app, componentType(apps[app]), team, fmt.Sprintf("launch/%s.yml", app))
+		if err != nil {
+			return err
+		}
+		components = append(components, c)
+	}
+
+	catalog, err := backstage.ReadCatalogFile(defaultCatalogInfoPath)
+	if err != nil {
+		return err
+	}
+	drift, err := catalog.Reconcile(components)
+	if err != nil {
+		return err
+	}
+	for _, d := range drift {
+		fmt.Println(d)
+	}
+	if len(drift) == 0 {
+		fmt.Println(defaultCatalogInfoPath, "matches the launch configs")
+		return nil
+	}
+	if !write {
+		return &ValidationError{Message: fmt.Sprintf("%s has drifted from the launch configs, run goci catalog --write to update it", defaultCatalogInfoPath)}
+	}
+	for _, d := range drift {
+		if d.Manual {
+			return &ValidationError{Message: fmt.Sprintf("%s cannot be written until the drift above is fixed by hand", defaultCatalogInfoPath)}
+		}
+	}
+	if err := catalog.Write(); err != nil {
+		return err
+	}
+	fmt.Println("updated", defaultCatalogInfoPath)
+	return nil
+}
+
+// componentType is the Backstage Component type of an application.
+func componentType(lc *models.LaunchConfig) string {
+	switch {
+	case repo.IsLambdaRunType(lc):
+		return "function"
+	case repo.IsSparkRunType(lc):
+		return "job"
+	default:
+		return "service"
+	}
+}
+
+// publishUtility syncs every entity in catalog-info.yaml, and the files
+// it points to, to the service catalog.
 func publishUtility() error {
 	validateRun()
-	catalogInfoPath := "./catalog-info.yaml"
+	catalogInfoPath := defaultCatalogInfoPath
 	if _, err := os.Stat(catalogInfoPath); os.IsNotExist(err) {
 		return fmt.Errorf("catalog-info.yaml file not found in the current directory")
 	}
-	catalogInfo, err := backstage.GetEntityFromYaml(catalogInfoPath)
+	entities, err := validateCatalog(catalogInfoPath)
 	if err != nil {
-		return fmt.Errorf("failed to read catalog-info.yaml file: %v", err)
+		return err
 	}
 
-	cp := catapult.New()
-
-	err = cp.SyncCatalogEntity(context.Background(), &ciIntegrationsModels.SyncCatalogEntityInput{
-		Entity: catalogInfo.GetName(),
-		Type:   "utility",
-	})
+	ctx := context.Background()
+	ci, err := integrations.NewFromEnv()
 	if err != nil {
-		return fmt.Errorf("failed to sync catalog entity with catapult: %v", err)
+		return err
 	}
-	fmt.Printf("Successfully synced catalog entity %s \n", catalogInfo.GetName())
-	return nil
+	events, err := platformevents.NewLifecycle(ctx)
+	if err != nil {
+		return err
+	}
+	ci.OnSync = events.CatalogSynced
+	syncs, err := integrations.NewSyncReport(environment.CatalogSyncPolicy())
+	if err != nil {
+		return err
+	}
+	repo := environment.Repo()
+	for _, e := range entities {
+		if !backstage.SupportedKind(e.Kind) {
+			fmt.Printf("Skipping catalog entity %s of unsupported kind %s\n", e.GetName(), e.Kind)
+			continue
+		}
+		syncType := e.SyncType()
+		if syncType == "" {
+			continue
+		}
+		err := ci.SyncCatalogEntity(ctx, &ciIntegrationsModels.SyncCatalogEntityInput{
+			Entity: e.GetName(),
+			Type:   syncType,
+			Repo:   &repo,
+		})
+		syncs.Record(e.GetName(), err)
+		if err == nil {
+			fmt.Printf("Successfully synced catalog entity %s \n", e.GetName())
+		}
+	}
+	return syncs.Finish()
+}
 
+// catapultDeployTargets resolves the environment and strategy of each
+// app from its stack config, with any flags taking precedence.
+func catapultDeployTargets(appIDs []string, opts options) ([]deploy.Target, error) {
+	freezes, err := repo.DeployFreezes()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	targets := []deploy.Target{}
+	for _, app := range appIDs {
+		cfg, err := repo.CatapultDeployConfig(app)
+		if err != nil {
+			return nil, err
+		}
+		t := deploy.Target{
+			App:         app,
+			Environment: cfg.Environment,
+			Strategy:    cfg.Strategy,
+			Revision:    environment.ShortSHA1(),
+		}
+		if opts.env != "" {
+			t.Environment = opts.env
+		}
+		if opts.strategy != "" {
+			t.Strategy = opts.strategy
+		}
+		if err := catapult.ValidateStrategy(t.Strategy); err != nil {
+			return nil, fmt.Errorf("invalid deploy configuration for %s: %v", app, err)
+		}
+		if f := repo.Frozen(freezes, t.Environment, now); f != nil {
+			fmt.Printf("Not deploying %s: deploys are frozen for %s until %s\n", t, f.Name, f.End.Format(time.RFC3339))
+			continue
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
 }
 
-func deployApps(appIds []string) error {
+func deployApps(appIds []string, opts options) error {
+	if opts.strategy != "" {
+		return fmt.Errorf("deployment strategies are only supported by catapult deploys in artifact-build-publish-deploy mode")
+	}
 	if len(appIds) == 0 {
 		fmt.Println("No applications have buildable changes. If this is unexpected, " +
 			"double check your artifact dependency configuration in the launch yaml.")
@@ -308,38 +706,215 @@ func deployApps(appIds []string) error {
 	}
 	ctx := context.Background()
 
-	cs := catalogsync.New()
+	syncs, err := integrations.NewSyncReport(environment.CatalogSyncPolicy())
+	if err != nil {
+		return err
+	}
+	ci, err := integrations.NewFromEnv()
+	if err != nil {
+		return err
+	}
+	events, err := platformevents.NewLifecycle(ctx)
+	if err != nil {
+		return err
+	}
+	ci.OnSync = events.CatalogSynced
 	repo := environment.Repo()
 	for _, appID := range appIds {
-		if err := cs.SyncEntity(ctx, &ciIntegrationsModels.SyncCatalogEntityInput{
+		syncs.Record(appID, ci.SyncCatalogEntity(ctx, &ciIntegrationsModels.SyncCatalogEntityInput{
 			Entity: appID,
 			Type:   "application",
 			Repo:   &repo,
-		}); err != nil {
-			fmt.Println("failed to sync catalog app", appID, "with catalog-sync-service:", err)
-		}
+		}))
 	}
 
-	if shouldDeploy() {
-		if err := platformevents.NewDeployPublisher(ctx).DeployApps(ctx, appIds); err != nil {
+	envs, err := deployEnvs(appIds, opts, time.Now())
+	if err != nil {
+		return err
+	}
+	if len(envs) > 0 {
+		runner, err := deployRunner(opts)
+		if err != nil {
+			return err
+		}
+		publisher, err := platformevents.NewDeployPublisher(ctx)
+		if err != nil {
+			return err
+		}
+		if publisher.Gate, err = deployGate(); err != nil {
+			return err
+		}
+		if publisher.Gate != nil {
+			publisher.Gate.Allow = deployAllowed(opts)
+		}
+		targets, summary, err := publisher.DeployApps(ctx, appIds, envs, runner)
+		if err != nil {
+			return err
+		}
+		deployments, err := stackDeployments(targets)
+		if err != nil {
+			return err
+		}
+		if err := errors.Join(recordDeploys(deployments, summary), finishDeploys(summary), syncs.Finish()); err != nil {
 			return err
 		}
+	} else if err := syncs.Finish(); err != nil {
+		return err
 	}
 	return validateRun()
 }
 
-func shouldDeploy() bool {
-	allowedBranches := os.Getenv("DEPLOY_BRANCHES")
-	if allowedBranches == "" {
-		allowedBranches = "master"
+// deployRunner configures how apps are deployed from the flags and the
+// deployAfter stack config of every app in the repo, so that the order
+// holds through apps which are not being deployed. If the wait flag is
+// set, each wave of deploys must roll out before the next starts.
+func deployRunner(opts options) (deploy.Runner, error) {
+	apps, err := repo.DiscoverAllApplications("./launch")
+	if err != nil {
+		return deploy.Runner{}, err
+	}
+	appIDs := make([]string, 0, len(apps))
+	for app := range apps {
+		appIDs = append(appIDs, app)
+	}
+	deployAfter, err := repo.DeployAfter(appIDs)
+	if err != nil {
+		return deploy.Runner{}, err
+	}
+	r := deploy.Runner{
+		Concurrency: opts.concurrency,
+		KeepGoing:   opts.keepGoing,
+		DeployAfter: deployAfter,
+	}
+	if opts.wait {
+		w := &deploy.Waiter{
+			Source: &deploy.HTTPStatusSource{
+				URL:      environment.DeployStatusURL(),
+				Username: environment.DeployStatusUser(),
+				Password: environment.DeployStatusPassword(),
+				Client:   &http.Client{Timeout: 15 * time.Second},
+			},
+			Interval: deployStatusInterval,
+			Timeout:  opts.waitTimeout,
+		}
+		r.Wait = w.WaitEach
 	}
+	return r, nil
+}
 
-	currentBranch := environment.Branch()
-	branches := strings.Split(allowedBranches, ",")
-	for _, branch := range branches {
-		if strings.TrimSpace(branch) == currentBranch {
-			return true
+// deployGate configures approval of deploys to the gated environments
+// of config/deploy.yaml, using the GOCI_APPROVER. It returns nil if no
+// environment is gated.
+func deployGate() (*deploy.Gate, error) {
+	cfg, err := repo.DeployApprovals()
+	if err != nil || cfg == nil {
+		return nil, err
+	}
+	timeout, err := cfg.TimeoutDuration()
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 15 * time.Second}
+	var approver deploy.Approver
+	switch a := environment.Approver(); a {
+	case "circleci":
+		approver = &deploy.CircleCIApprover{
+			APIURL:     environment.CircleAPIURL(),
+			Token:      environment.CircleToken(),
+			WorkflowID: environment.CircleWorkflowID(),
+			Job:        environment.ApprovalJob(),
+			Client:     client,
 		}
+	case "http":
+		approver = &deploy.HTTPApprover{
+			URL:    environment.ApprovalURL(),
+			Token:  environment.ApprovalToken(),
+			Client: client,
+		}
+	case "file":
+		approver = &deploy.FileApprover{Dir: environment.ApprovalDir()}
+	default:
+		return nil, fmt.Errorf("unknown approver %q, expected circleci, http or file", a)
+	}
+	return &deploy.Gate{
+		Approver:     approver,
+		Environments: cfg.Environments,
+		Interval:     deployStatusInterval,
+		Timeout:      timeout,
+	}, nil
+}
+
+// finishDeploys prints and records the summary of all deploys. An error
+// is returned if any deploy failed.
+func finishDeploys(summary *deploy.Summary) error {
+	fmt.Println("Deploy summary:")
+	summary.Print(os.Stdout)
+	if err := summary.WriteJSON(environment.DeploySummaryPath()); err != nil {
+		return err
+	}
+	return summary.Err()
+}
+
+// deployEnvs evaluates the deploy rules of each app against the branch
+// being built, logging why each environment is or is not deployed. Apps
+// without deploy rules are deployed to the --env environment from the
+// DEPLOY_BRANCHES, if it is set.
+func deployEnvs(apps []string, opts options, now time.Time) (map[string][]string, error) {
+	freezes, err := repo.DeployFreezes()
+	if err != nil {
+		return nil, err
+	}
+	branch := environment.Branch()
+	envs := map[string][]string{}
+	for _, app := range apps {
+		rules, err := appDeployRules(app, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, d := range repo.EvaluateDeployRules(rules, freezes, branch, opts.env, now) {
+			if !d.Deploy {
+				fmt.Printf("Not deploying %s to %s: %s\n", app, d.Environment, d.Reason)
+				continue
+			}
+			fmt.Printf("Deploying %s to %s: %s\n", app, d.Environment, d.Reason)
+			envs[app] = append(envs[app], d.Environment)
+		}
+	}
+	return envs, nil
+}
+
+// appDeployRules returns the deploy rules of the app. An app without
+// rules deploys to the --env environment from DEPLOY_BRANCHES.
+func appDeployRules(app string, opts options) ([]repo.DeployRule, error) {
+	rules, err := repo.DeployRules(app, environment.DeployBranches())
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 && opts.env != "" {
+		for _, b := range environment.DeployBranches() {
+			rules = append(rules, repo.DeployRule{Branch: b, Environments: []string{opts.env}})
+		}
+	}
+	return rules, nil
+}
+
+// deployAllowed returns a check that the deploy rules and freezes still
+// allow a deploy, for once it has waited for approval.
+func deployAllowed(opts options) func(deploy.Target) error {
+	return func(t deploy.Target) error {
+		freezes, err := repo.DeployFreezes()
+		if err != nil {
+			return err
+		}
+		rules, err := appDeployRules(t.App, opts)
+		if err != nil {
+			return err
+		}
+		for _, d := range repo.EvaluateDeployRules(rules, freezes, environment.Branch(), opts.env, time.Now()) {
+			if d.Environment == t.Environment && !d.Deploy {
+				return errors.New(d.Reason)
+			}
+		}
+		return nil
 	}
-	return false
 }
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Clever/catapult/gen-go/models"
+	"github.com/Clever/ci-scripts/internal/deploy"
+	"github.com/Clever/ci-scripts/internal/docker"
+	"github.com/Clever/ci-scripts/internal/environment"
+	"github.com/Clever/ci-scripts/internal/lambda"
+	"github.com/Clever/ci-scripts/internal/platformevents"
+	"github.com/Clever/ci-scripts/internal/repo"
+)
+
+// rollback redeploys the app at the revision deployed before its current
+// one, in the --env environment or else every environment its deploy
+// rules name. The artifact of the previous revision must still exist.
+func rollback(opts options) error {
+	if len(opts.args) != 1 {
+		return fmt.Errorf("rollback needs the app to roll back. %s", usage)
+	}
+	app := opts.args[0]
+	apps, err := repo.DiscoverAllApplications("./launch")
+	if err != nil {
+		return err
+	}
+	launch, ok := apps[app]
+	if !ok {
+		return fmt.Errorf("no launch config for app %s", app)
+	}
+
+	envs := []string{opts.env}
+	if opts.env == "" {
+		if envs, err = ruleEnvironments(app); err != nil {
+			return err
+		}
+	}
+	history, err := deployHistory()
+	if err != nil {
+		return err
+	}
+	if history == nil {
+		return fmt.Errorf("no deploy history to roll back %s with: set GOCI_DEPLOY_HISTORY to http, or to file with GOCI_DEPLOY_HISTORY_PATH kept between builds", app)
+	}
+
+	ctx := context.Background()
+	var (
+		targets     []deploy.Target
+		deployments []deploy.Deployment
+		overrides   = map[string]*repo.DeployOverrides{}
+	)
+	for _, env := range envs {
+		current, previous, err := deploy.PreviousRevision(ctx, history, app, env)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rolling back %s in %s from %s to %s, deployed %s\n", app, env, current, previous.Revision, previous.Time.Format(time.RFC3339))
+		if err := artifactExists(ctx, app, launch, previous.Revision); err != nil {
+			return fmt.Errorf("cannot roll back %s to %s: %v", app, previous.Revision, err)
+		}
+		o := previous.Overrides
+		if o == nil {
+			fmt.Printf("The deploy of %s to %s was recorded without its overrides, using those in config/%s/stack.yaml\n", previous.Revision, env, app)
+			if o, err = repo.DeployOverridesFor(app, env); err != nil {
+				return err
+			}
+		}
+		overrides[env] = o
+		targets = append(targets, deploy.Target{App: app, Environment: env, Revision: previous.Revision})
+		deployments = append(deployments, deploy.Deployment{App: app, Environment: env, Revision: previous.Revision, RollbackOf: current, Overrides: o})
+	}
+
+	runner, err := deployRunner(opts)
+	if err != nil {
+		return err
+	}
+	publisher, err := platformevents.NewDeployPublisher(ctx)
+	if err != nil {
+		return err
+	}
+	if publisher.Gate, err = deployGate(); err != nil {
+		return err
+	}
+	// The revision is redeployed the way it was deployed, rather than
+	// with the overrides in the current stack.yaml.
+	publisher.Overrides = func(t deploy.Target) (*repo.DeployOverrides, error) {
+		return overrides[t.Environment], nil
+	}
+	summary, err := publisher.Deploy(ctx, targets, runner)
+	if err != nil {
+		return err
+	}
+	return errors.Join(recordDeploys(deployments, summary), finishDeploys(summary))
+}
+
+// ruleEnvironments returns every environment named by the app's deploy
+// rules.
+func ruleEnvironments(app string) ([]string, error) {
+	rules, err := repo.DeployRules(app, environment.DeployBranches())
+	if err != nil {
+		return nil, err
+	}
+	var (
+		envs []string
+		seen = map[string]bool{}
+	)
+	for _, r := range rules {
+		for _, env := range r.Environments {
+			if !seen[env] {
+				seen[env] = true
+				envs = append(envs, env)
+			}
+		}
+	}
+	if len(envs) == 0 {
+		return nil, fmt.Errorf("%s has no deploy rules, pass --env to choose the environment to roll back", app)
+	}
+	return envs, nil
+}
+
+// artifactExists returns an error unless the app's artifact built at the
+// revision is still in ECR or S3.
+func artifactExists(ctx context.Context, app string, launch *models.LaunchConfig, revision string) error {
+	artifact := repo.ArtifactName(app, launch)
+	switch {
+	case repo.IsDockerRunType(launch):
+		return docker.ImageExists(ctx, environment.OidcEcrUploadRole(), artifact, revision)
+	case repo.IsLambdaRunType(launch):
+		buckets, err := lambda.AppBuckets(app)
+		if err != nil {
+			return err
+		}
+		return lambda.New(ctx).ArtifactExists(ctx, artifact, revision, buckets)
+	default:
+		return fmt.Errorf("only docker and lambda apps can be rolled back")
+	}
+}
+
+// deployHistory returns the GOCI_DEPLOY_HISTORY provider of past deploys,
+// or nil if none is configured.
+func deployHistory() (deploy.History, error) {
+	switch h := environment.DeployHistory(); h {
+	case "":
+		return nil, nil
+	case "file":
+		return &deploy.FileHistory{Path: environment.DeployHistoryPath()}, nil
+	case "http":
+		return &deploy.HTTPHistory{
+			URL:    environment.DeployHistoryURL(),
+			Token:  environment.DeployHistoryToken(),
+			Client: &http.Client{Timeout: 15 * time.Second},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown deploy history %q, expected file or http", h)
+	}
+}
+
+// recordDeploys adds the successful deploys to the deploy history, if
+// one is configured. The deployments are index-aligned with the
+// summary's results.
+func recordDeploys(deployments []deploy.Deployment, summary *deploy.Summary) error {
+	history, err := deployHistory()
+	if err != nil || history == nil {
+		return err
+	}
+	if err := deploy.Record(history, deployments, summary); err != nil {
+		return fmt.Errorf("failed to record deploy history: %v", err)
+	}
+	return nil
+}
+
+// stackDeployments returns the deployments of the targets with the
+// overrides in config/<app>/stack.yaml, for recording in the history.
+func stackDeployments(targets []deploy.Target) ([]deploy.Deployment, error) {
+	deployments := make([]deploy.Deployment, len(targets))
+	for i, t := range targets {
+		o, err := repo.DeployOverridesFor(t.App, t.Environment)
+		if err != nil {
+			return nil, err
+		}
+		deployments[i] = deploy.Deployment{App: t.App, Environment: t.Environment, Revision: t.Revision, Overrides: o}
+	}
+	return deployments, nil
+}
@@ -7,14 +7,18 @@ require (
 	github.com/Clever/circle-ci-integrations/gen-go/client v0.15.0
 	github.com/Clever/circle-ci-integrations/gen-go/models v0.15.0
 	github.com/Clever/wag/logging/wagclientlogger v0.0.0-20250514163731-344287ef8d81
+	github.com/andybalholm/brotli v1.2.0
 	github.com/aws/aws-sdk-go-v2 v1.41.9
 	github.com/aws/aws-sdk-go-v2/config v1.29.17
 	github.com/aws/aws-sdk-go-v2/credentials v1.17.70
+	github.com/aws/aws-sdk-go-v2/feature/s3/manager v1.17.83
 	github.com/aws/aws-sdk-go-v2/service/ecr v1.45.1
 	github.com/aws/aws-sdk-go-v2/service/eventbridge v1.46.2
+	github.com/aws/aws-sdk-go-v2/service/lambda v1.72.0
 	github.com/aws/aws-sdk-go-v2/service/s3 v1.83.0
 	github.com/aws/aws-sdk-go-v2/service/sts v1.34.0
 	github.com/docker/docker v23.0.2+incompatible
+	github.com/getkin/kin-openapi v0.139.0
 	github.com/ghodss/yaml v1.0.1-0.20190212211648-25d852aebe32
 	github.com/moby/buildkit v0.11.5
 	golang.org/x/sync v0.19.0
@@ -44,7 +48,6 @@ require (
 	github.com/docker/go-connections v0.4.0 // indirect
 	github.com/docker/go-units v0.5.0 // indirect
 	github.com/dprotaso/go-yit v0.0.0-20220510233725-9ba8df137936 // indirect
-	github.com/getkin/kin-openapi v0.139.0 // indirect
 	github.com/go-openapi/analysis v0.24.1 // indirect
 	github.com/go-openapi/errors v0.22.4 // indirect
 	github.com/go-openapi/jsonpointer v0.22.4 // indirect
@@ -105,4 +108,7 @@ replace (
 	github.com/Clever/workflow-manager/gen-go/models => github.com/Clever/workflow-manager/gen-go/models v0.16.2
 )
 
-tool github.com/Clever/slingshot/cmd/schemabindings
+tool (
+	github.com/Clever/slingshot/cmd/schemabindings
+	github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen
+)
@@ -1,42 +1,194 @@
 package backstage
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
+// Entity kinds goci understands.
+const (
+	KindComponent = "Component"
+	KindAPI       = "API"
+	KindResource  = "Resource"
+	KindSystem    = "System"
+	KindGroup     = "Group"
+	KindLocation  = "Location"
+)
+
 // BackstageEntity represents a generic Backstage entity.
 type Entity struct {
-	APIVersion string                 `json:"apiVersion"` // The API version of the entity (e.g., "backstage.io/v1alpha1").
-	Kind       string                 `json:"kind"`       // The kind of the entity (e.g., "Component", "API").
-	Metadata   Metadata               `json:"metadata"`   // Metadata about the entity.
-	Spec       map[string]interface{} `json:"spec"`       // The specification of the entity (varies by kind).
+	APIVersion string    `yaml:"apiVersion"` // The API version of the entity (e.g., "backstage.io/v1alpha1").
+	Kind       string    `yaml:"kind"`       // The kind of the entity (e.g., "Component", "API").
+	Metadata   Metadata  `yaml:"metadata"`   // Metadata about the entity.
+	RawSpec    yaml.Node `yaml:"spec"`       // The specification of the entity (varies by kind).
+
+	// File is the path of the file the entity was read from.
+	File string `yaml:"-"`
 }
 
 // BackstageMetadata represents the metadata of a Backstage entity.
 type Metadata struct {
-	Name        string            `json:"name"`                  // The name of the entity.
-	Namespace   string            `json:"namespace,omitempty"`   // The namespace of the entity (optional).
-	Description string            `json:"description,omitempty"` // A description of the entity (optional).
-	Labels      map[string]string `json:"labels,omitempty"`      // Labels for the entity (optional).
-	Annotations map[string]string `json:"annotations,omitempty"` // Annotations for the entity (optional).
-	Tags        []string          `json:"tags,omitempty"`        // Tags for the entity (optional).
+	Name        string            `yaml:"name"`                  // The name of the entity.
+	Namespace   string            `yaml:"namespace,omitempty"`   // The namespace of the entity (optional).
+	Description string            `yaml:"description,omitempty"` // A description of the entity (optional).
+	Labels      map[string]string `yaml:"labels,omitempty"`      // Labels for the entity (optional).
+	Annotations map[string]string `yaml:"annotations,omitempty"` // Annotations for the entity (optional).
+	Tags        []string          `yaml:"tags,omitempty"`        // Tags for the entity (optional).
+}
+
+// ComponentSpec is the spec of a Component entity.
+type ComponentSpec struct {
+	Type           string   `yaml:"type"`
+	Lifecycle      string   `yaml:"lifecycle"`
+	Owner          string   `yaml:"owner,omitempty"`
+	System         string   `yaml:"system,omitempty"`
+	SubcomponentOf string   `yaml:"subcomponentOf,omitempty"`
+	ProvidesAPIs   []string `yaml:"providesApis,omitempty"`
+	ConsumesAPIs   []string `yaml:"consumesApis,omitempty"`
+	DependsOn      []string `yaml:"dependsOn,omitempty"`
+}
+
+// APISpec is the spec of an API entity.
+type APISpec struct {
+	Type       string `yaml:"type"`
+	Lifecycle  string `yaml:"lifecycle"`
+	Owner      string `yaml:"owner"`
+	System     string `yaml:"system,omitempty"`
+	Definition string `yaml:"definition"`
+}
+
+// ResourceSpec is the spec of a Resource entity.
+type ResourceSpec struct {
+	Type      string   `yaml:"type"`
+	Owner     string   `yaml:"owner"`
+	System    string   `yaml:"system,omitempty"`
+	DependsOn []string `yaml:"dependsOn,omitempty"`
+}
+
+// SystemSpec is the spec of a System entity.
+type SystemSpec struct {
+	Owner  string `yaml:"owner"`
+	Domain string `yaml:"domain,omitempty"`
 }
 
-// GetEntityFromYaml reads a yaml file and returns a BackstageEntity.
-func GetEntityFromYaml(filePath string) (*Entity, error) {
-	data, err := os.ReadFile(filePath)
+// GroupSpec is the spec of a Group entity.
+type GroupSpec struct {
+	Type     string   `yaml:"type"`
+	Parent   string   `yaml:"parent,omitempty"`
+	Children []string `yaml:"children"`
+	Members  []string `yaml:"members,omitempty"`
+}
+
+// LocationSpec is the spec of a Location entity, which points at other
+// catalog files.
+type LocationSpec struct {
+	// Type is file or url. It defaults to file.
+	Type    string   `yaml:"type,omitempty"`
+	Target  string   `yaml:"target,omitempty"`
+	Targets []string `yaml:"targets,omitempty"`
+}
+
+// GetEntitiesFromYaml reads every entity in a yaml file, which may hold
+// multiple documents separated by ---. Empty documents are skipped.
+func GetEntitiesFromYaml(filePath string) ([]*Entity, error) {
+	f, err := os.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file %s: %v", filePath, err)
 	}
-	var entity Entity
-	err = yaml.Unmarshal(data, &entity)
+	defer f.Close()
+
+	var entities []*Entity
+	dec := yaml.NewDecoder(f)
+	for doc := 1; ; doc++ {
+		var entity Entity
+		err := dec.Decode(&entity)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal yaml document %d of %s: %v", doc, filePath, err)
+		}
+		if entity.Kind == "" && entity.APIVersion == "" && entity.Metadata.Name == "" {
+			continue
+		}
+		entity.File = filePath
+		entities = append(entities, &entity)
+	}
+	return entities, nil
+}
+
+// LoadCatalog reads the entities in the file and, recursively, in the
+// local files targeted by its Location entities. Location entities are
+// included in the result. File targets are relative to the file
+// declaring them and may be globs. Url targets are left for the catalog
+// to resolve.
+func LoadCatalog(filePath string) ([]*Entity, error) {
+	return loadCatalog(filepath.Clean(filePath), map[string]bool{})
+}
+
+func loadCatalog(filePath string, seen map[string]bool) ([]*Entity, error) {
+	if seen[filePath] {
+		return nil, nil
+	}
+	seen[filePath] = true
+
+	entities, err := GetEntitiesFromYaml(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal yaml: %v", err)
+		return nil, err
+	}
+	all := entities
+	for _, e := range entities {
+		if e.Kind != KindLocation {
+			continue
+		}
+		targets, err := e.localTargets()
+		if err != nil {
+			return nil, err
+		}
+		for _, target := range targets {
+			found, err := loadCatalog(target, seen)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, found...)
+		}
 	}
-	return &entity, nil
+	return all, nil
+}
+
+// localTargets returns the files a file Location points to.
+func (e *Entity) localTargets() ([]string, error) {
+	spec, err := e.Spec()
+	if err != nil {
+		return nil, fmt.Errorf("location %s in %s: %v", e.GetName(), e.File, err)
+	}
+	loc := spec.(*LocationSpec)
+	if loc.Type != "" && loc.Type != "file" {
+		return nil, nil
+	}
+
+	var files []string
+	for _, target := range append([]string{loc.Target}, loc.Targets...) {
+		if target == "" {
+			continue
+		}
+		pattern := filepath.Join(filepath.Dir(e.File), strings.TrimPrefix(target, "file:"))
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("location %s in %s has invalid target %q: %v", e.GetName(), e.File, target, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("location %s in %s targets %q, which does not exist", e.GetName(), e.File, target)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
 }
 
 func (e *Entity) GetName() string {
@@ -45,3 +197,74 @@ func (e *Entity) GetName() string {
 	}
 	return e.Metadata.Name
 }
+
+// Spec decodes the spec into the typed spec of the entity's kind, e.g.
+// a *ComponentSpec for a Component.
+func (e *Entity) Spec() (interface{}, error) {
+	var spec interface{}
+	switch e.Kind {
+	case KindComponent:
+		spec = &ComponentSpec{}
+	case KindAPI:
+		spec = &APISpec{}
+	case KindResource:
+		spec = &ResourceSpec{}
+	case KindSystem:
+		spec = &SystemSpec{}
+	case KindGroup:
+		spec = &GroupSpec{}
+	case KindLocation:
+		spec = &LocationSpec{}
+	default:
+		return nil, fmt.Errorf("unsupported entity kind %q", e.Kind)
+	}
+	if e.RawSpec.IsZero() {
+		return spec, nil
+	}
+	if err := e.RawSpec.Decode(spec); err != nil {
+		return nil, fmt.Errorf("invalid %s spec: %v", e.Kind, err)
+	}
+	return spec, nil
+}
+
+// componentSyncTypes maps Component spec types to the catalog-config
+// entity type they are synced as. Other spec types are synced as
+// themselves.
+var componentSyncTypes = map[string]string{
+	"service":  "application",
+	"website":  "application",
+	"function": "application",
+	"job":      "application",
+	"library":  "utility",
+	"tool":     "utility",
+}
+
+// SyncType is the catalog-config entity type the entity is synced as.
+// Components are synced by their spec type and other kinds by their
+// lowercased kind. Components generated from a launch config are synced
+// as applications by deploy-apps, so they, Location entities and kinds
+// goci does not support are not synced and return an empty string.
+func (e *Entity) SyncType() string {
+	if !SupportedKind(e.Kind) {
+		return ""
+	}
+	switch e.Kind {
+	case KindComponent:
+		if e.Metadata.Annotations[LaunchConfigAnnotation] != "" {
+			return ""
+		}
+		spec, err := e.Spec()
+		if err != nil {
+			return ""
+		}
+		componentType := strings.ToLower(spec.(*ComponentSpec).Type)
+		if t, ok := componentSyncTypes[componentType]; ok {
+			return t
+		}
+		return componentType
+	case KindLocation:
+		return ""
+	default:
+		return strings.ToLower(e.Kind)
+	}
+}
@@ -0,0 +1,32 @@
+package backstage
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestSyncType(t *testing.T) {
+	for _, tc := range []struct {
+		entity string
+		want   string
+	}{
+		{entity: "kind: Component\nmetadata: {name: a}\nspec: {type: service}", want: "application"},
+		{entity: "kind: Component\nmetadata: {name: a}\nspec: {type: function}", want: "application"},
+		{entity: "kind: Component\nmetadata: {name: a}\nspec: {type: library}", want: "utility"},
+		{entity: "kind: Component\nmetadata: {name: a}\nspec: {type: Utility}", want: "utility"},
+		{entity: "kind: Component\nmetadata: {name: a}\nspec: {type: data-pipeline}", want: "data-pipeline"},
+		{entity: "kind: Component\nmetadata: {name: a, annotations: {clever.com/launch-config: launch/a.yml}}\nspec: {type: service}", want: ""},
+		{entity: "kind: API\nmetadata: {name: a}\nspec: {type: openapi}", want: "api"},
+		{entity: "kind: Location\nmetadata: {name: a}\nspec: {targets: [./a.yaml]}", want: ""},
+		{entity: "kind: Domain\nmetadata: {name: a}\nspec: {owner: team-a}", want: ""},
+	} {
+		var e Entity
+		if err := yaml.Unmarshal([]byte(tc.entity), &e); err != nil {
+			t.Fatal(err)
+		}
+		if got := e.SyncType(); got != tc.want {
+			t.Errorf("%q: expected sync type %q, got %q", tc.entity, tc.want, got)
+		}
+	}
+}
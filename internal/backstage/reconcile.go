@@ -0,0 +1,235 @@
+package backstage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LaunchConfigAnnotation marks a Component generated from a launch
+// config, holding the path of the launch config.
+const LaunchConfigAnnotation = "clever.com/launch-config"
+
+// defaultLifecycle is the lifecycle of new generated Components.
+const defaultLifecycle = "production"
+
+// NewComponent returns the Component generated for an application from
+// its launch config. Owner is omitted if the team is unknown, which
+// Reconcile reports as manual drift.
+func NewComponent(app, componentType, owner, launchConfig string) (*Entity, error) {
+	e := &Entity{
+		APIVersion: "backstage.io/v1alpha1",
+		Kind:       KindComponent,
+		Metadata: Metadata{
+			Name:        app,
+			Annotations: map[string]string{LaunchConfigAnnotation: launchConfig},
+		},
+	}
+	err := e.RawSpec.Encode(&ComponentSpec{
+		Type:      componentType,
+		Lifecycle: defaultLifecycle,
+		Owner:     owner,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Drift is a difference between a generated entity and the catalog file.
+type Drift struct {
+	Entity  string
+	Message string
+	// Manual drift cannot be fixed by rewriting the file, e.g. a Component
+	// whose owner cannot be generated.
+	Manual bool
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s: %s", d.Entity, d.Message)
+}
+
+// CatalogFile is a catalog file which is reconciled with generated
+// entities and written back. Fields and comments which are not
+// generated are preserved.
+type CatalogFile struct {
+	path string
+	docs []*yaml.Node
+}
+
+// ReadCatalogFile reads every document in the catalog file. A missing
+// file is treated as empty.
+func ReadCatalogFile(path string) (*CatalogFile, error) {
+	c := &CatalogFile{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, fmt.Errorf("failed to read file %s: %v", path, err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal yaml in %s: %v", path, err)
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+		c.docs = append(c.docs, &doc)
+	}
+	return c, nil
+}
+
+// Reconcile updates the file with the generated Components and returns
+// every difference found. For each Component the annotation, type and
+// owner are generated, a missing lifecycle is defaulted and every other
+// field is left to the user. Components are added if missing, and
+// generated Components whose application no longer exists are removed.
+func (c *CatalogFile) Reconcile(components []*Entity) ([]Drift, error) {
+	var drift []Drift
+	generated := map[string]bool{}
+	for _, e := range components {
+		generated[e.GetName()] = true
+		typed, err := e.Spec()
+		if err != nil {
+			return nil, err
+		}
+		want := typed.(*ComponentSpec)
+
+		doc := c.component(e.GetName())
+		if want.Owner == "" && (doc == nil || scalarAt(doc.Content[0], "spec", "owner") == "") {
+			drift = append(drift, Drift{
+				Entity:  e.GetName(),
+				Message: fmt.Sprintf("no team in %s to generate the owner from", e.Metadata.Annotations[LaunchConfigAnnotation]),
+				Manual:  true,
+			})
+		}
+		if doc == nil {
+			var node yaml.Node
+			if err := node.Encode(e); err != nil {
+				return nil, err
+			}
+			c.docs = append(c.docs, &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&node}})
+			drift = append(drift, Drift{Entity: e.GetName(), Message: "missing from the catalog"})
+			continue
+		}
+
+		root := doc.Content[0]
+		annotations := mapping(mapping(root, "metadata"), "annotations")
+		spec := mapping(root, "spec")
+		set := func(m *yaml.Node, key, value string) {
+			if have, changed := setScalar(m, key, value); changed {
+				drift = append(drift, Drift{Entity: e.GetName(), Message: fmt.Sprintf("%s is %q, expected %q", key, have, value)})
+			}
+		}
+		set(annotations, LaunchConfigAnnotation, e.Metadata.Annotations[LaunchConfigAnnotation])
+		set(spec, "type", want.Type)
+		if want.Owner != "" {
+			set(spec, "owner", want.Owner)
+		}
+		if field(spec, "lifecycle") == nil {
+			set(spec, "lifecycle", want.Lifecycle)
+		}
+	}
+
+	docs := c.docs[:0]
+	for _, doc := range c.docs {
+		root := doc.Content[0]
+		name := scalarAt(root, "metadata", "name")
+		if scalarAt(root, "kind") == KindComponent && scalarAt(root, "metadata", "annotations", LaunchConfigAnnotation) != "" && !generated[name] {
+			drift = append(drift, Drift{Entity: name, Message: "launch config no longer exists"})
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	c.docs = docs
+	return drift, nil
+}
+
+// Write writes the documents back to the file.
+func (c *CatalogFile) Write() error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	for _, doc := range c.docs {
+		if err := enc.Encode(doc); err != nil {
+			return fmt.Errorf("failed to marshal %s: %v", c.path, err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("failed to marshal %s: %v", c.path, err)
+	}
+	if err := os.WriteFile(c.path, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", c.path, err)
+	}
+	return nil
+}
+
+// component returns the document of the named Component.
+func (c *CatalogFile) component(name string) *yaml.Node {
+	for _, doc := range c.docs {
+		root := doc.Content[0]
+		if scalarAt(root, "kind") == KindComponent && scalarAt(root, "metadata", "name") == name {
+			return doc
+		}
+	}
+	return nil
+}
+
+// mapping returns the mapping of the key in the mapping node, adding an
+// empty mapping if the key is missing.
+func mapping(m *yaml.Node, key string) *yaml.Node {
+	if n := field(m, key); n != nil {
+		if n.Kind != yaml.MappingNode {
+			*n = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		return n
+	}
+	n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, n)
+	return n
+}
+
+// setScalar sets the key in the mapping node to the value. The previous
+// value is returned, along with whether it changed.
+func setScalar(m *yaml.Node, key, value string) (string, bool) {
+	if n := field(m, key); n != nil {
+		have := n.Value
+		if n.Kind == yaml.ScalarNode && have == value {
+			return have, false
+		}
+		*n = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, LineComment: n.LineComment}
+		return have, true
+	}
+	m.Content = append(m.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value},
+	)
+	return "", true
+}
+
+// scalarAt returns the scalar value at the path of keys, or an empty
+// string if there is none.
+func scalarAt(n *yaml.Node, keys ...string) string {
+	for _, key := range keys {
+		if n == nil || n.Kind != yaml.MappingNode {
+			return ""
+		}
+		n = field(n, key)
+	}
+	if n == nil || n.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return n.Value
+}
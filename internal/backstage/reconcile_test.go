@@ -0,0 +1,192 @@
+package backstage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReconcile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog-info.yaml")
+	err := os.WriteFile(path, []byte(`apiVersion: backstage.io/v1alpha1
+kind: Component
+metadata:
+  name: my-test-app
+  description: The test app # written by hand
+  annotations:
+    clever.com/launch-config: launch/my-test-app.yml
+spec:
+  type: service
+  lifecycle: experimental
+  owner: old-team
+---
+apiVersion: backstage.io/v1alpha1
+kind: Component
+metadata:
+  name: removed-app
+  annotations:
+    clever.com/launch-config: launch/removed-app.yml
+spec:
+  type: service
+  lifecycle: production
+  owner: eng-infra
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var components []*Entity
+	for _, app := range []string{"my-test-app", "new-app"} {
+		e, err := NewComponent(app, "service", "eng-infra", "launch/"+app+".yml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		components = append(components, e)
+	}
+
+	c, err := ReadCatalogFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drift, err := c.Reconcile(components)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`my-test-app: owner is "old-team", expected "eng-infra"`,
+		`new-app: missing from the catalog`,
+		`removed-app: launch config no longer exists`,
+	}
+	if len(drift) != len(want) {
+		t.Fatalf("expected drift %v, got %v", want, drift)
+	}
+	for i, d := range drift {
+		if d.String() != want[i] {
+			t.Errorf("expected drift %q, got %q", want[i], d.String())
+		}
+	}
+
+	if err := c.Write(); err != nil {
+		t.Fatal(err)
+	}
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(bs)
+	for _, s := range []string{"description: The test app # written by hand", "lifecycle: experimental", "name: new-app"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected rewritten file to contain %q:\n%s", s, out)
+		}
+	}
+	if strings.Contains(out, "removed-app") {
+		t.Errorf("expected removed-app to be removed:\n%s", out)
+	}
+
+	c, err = ReadCatalogFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drift, err := c.Reconcile(components); err != nil || len(drift) > 0 {
+		t.Errorf("expected no drift after rewrite, got %v %v", drift, err)
+	}
+}
+
+func TestReconciledSyncTypes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog-info.yaml")
+	err := os.WriteFile(path, []byte(`apiVersion: backstage.io/v1alpha1
+kind: Component
+metadata:
+  name: my-utility
+spec:
+  type: library
+  lifecycle: production
+  owner: eng-infra
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := NewComponent("my-test-app", "service", "eng-infra", "launch/my-test-app.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := ReadCatalogFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Reconcile([]*Entity{app}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Apps are synced as applications by deploy-apps, so publish-utility
+	// must not sync them again.
+	entities, err := LoadCatalog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, e := range entities {
+		got[e.GetName()] = e.SyncType()
+	}
+	want := map[string]string{"my-utility": "utility", "my-test-app": ""}
+	if len(got) != len(want) || got["my-utility"] != want["my-utility"] || got["my-test-app"] != want["my-test-app"] {
+		t.Errorf("expected sync types %v, got %v", want, got)
+	}
+}
+
+func TestReconcileWithoutTeam(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog-info.yaml")
+	err := os.WriteFile(path, []byte(`apiVersion: backstage.io/v1alpha1
+kind: Component
+metadata:
+  name: owned-app
+  annotations:
+    clever.com/launch-config: launch/owned-app.yml
+spec:
+  type: service
+  lifecycle: production
+  owner: eng-infra
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var components []*Entity
+	for _, app := range []string{"owned-app", "new-app"} {
+		e, err := NewComponent(app, "service", "", "launch/"+app+".yml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		components = append(components, e)
+	}
+	c, err := ReadCatalogFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drift, err := c.Reconcile(components)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An owner written by hand is kept, but a new Component has none.
+	want := []Drift{
+		{Entity: "new-app", Message: "no team in launch/new-app.yml to generate the owner from", Manual: true},
+		{Entity: "new-app", Message: "missing from the catalog"},
+	}
+	if len(drift) != len(want) || drift[0] != want[0] || drift[1] != want[1] {
+		t.Fatalf("expected drift %v, got %v", want, drift)
+	}
+	if err := c.Write(); err != nil {
+		t.Fatal(err)
+	}
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(bs), `owner: ""`) {
+		t.Errorf("expected no empty owner:\n%s", bs)
+	}
+}
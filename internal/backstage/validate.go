@@ -0,0 +1,379 @@
+package backstage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Backstage naming rules, see
+// https://backstage.io/docs/features/software-catalog/descriptor-format
+var (
+	namePattern      = regexp.MustCompile(`^[a-zA-Z0-9]+([-_.][a-zA-Z0-9]+)*$`)
+	namespacePattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	tagPattern       = regexp.MustCompile(`^[a-z0-9:+#]+(-[a-z0-9:+#]+)*$`)
+	refPattern       = regexp.MustCompile(`^(?:([^:/]+):)?(?:([^:/]+)/)?([^:/]+)$`)
+)
+
+const maxNameLength = 63
+
+var apiVersions = []string{"backstage.io/v1alpha1", "backstage.io/v1beta1"}
+
+// specField describes a field of an entity spec.
+type specField struct {
+	key      string
+	required bool
+	list     bool
+	// refKinds are the entity kinds a reference field may refer to.
+	// It is empty for fields which are not references.
+	refKinds []string
+	// defaultKind is the kind of a reference which does not include
+	// one. References without a kind are invalid if it is empty.
+	defaultKind string
+}
+
+var specFields = map[string][]specField{
+	KindComponent: {
+		{key: "type", required: true},
+		{key: "lifecycle", required: true},
+		{key: "owner", required: true, refKinds: []string{"group", "user"}, defaultKind: "group"},
+		{key: "system", refKinds: []string{"system"}, defaultKind: "system"},
+		{key: "subcomponentOf", refKinds: []string{"component"}, defaultKind: "component"},
+		{key: "providesApis", list: true, refKinds: []string{"api"}, defaultKind: "api"},
+		{key: "consumesApis", list: true, refKinds: []string{"api"}, defaultKind: "api"},
+		{key: "dependsOn", list: true, refKinds: []string{"component", "resource"}},
+	},
+	KindAPI: {
+		{key: "type", required: true},
+		{key: "lifecycle", required: true},
+		{key: "owner", required: true, refKinds: []string{"group", "user"}, defaultKind: "group"},
+		{key: "system", refKinds: []string{"system"}, defaultKind: "system"},
+		{key: "definition", required: true},
+	},
+	KindResource: {
+		{key: "type", required: true},
+		{key: "owner", required: true, refKinds: []string{"group", "user"}, defaultKind: "group"},
+		{key: "system", refKinds: []string{"system"}, defaultKind: "system"},
+		{key: "dependsOn", list: true, refKinds: []string{"component", "resource"}},
+	},
+	KindSystem: {
+		{key: "owner", required: true, refKinds: []string{"group", "user"}, defaultKind: "group"},
+		{key: "domain", refKinds: []string{"domain"}, defaultKind: "domain"},
+	},
+	KindGroup: {
+		{key: "type", required: true},
+		{key: "parent", refKinds: []string{"group"}, defaultKind: "group"},
+		{key: "children", required: true, list: true, refKinds: []string{"group"}, defaultKind: "group"},
+		{key: "members", list: true, refKinds: []string{"user"}, defaultKind: "user"},
+	},
+	KindLocation: {
+		{key: "type"},
+		{key: "target"},
+		{key: "targets", list: true},
+	},
+}
+
+// Problem is a single validation failure at a position in the file.
+// Warnings do not make the file invalid.
+type Problem struct {
+	Line    int
+	Column  int
+	Message string
+	Warning bool
+}
+
+func (p Problem) String() string {
+	if p.Warning {
+		return fmt.Sprintf("%d:%d: warning: %s", p.Line, p.Column, p.Message)
+	}
+	return fmt.Sprintf("%d:%d: %s", p.Line, p.Column, p.Message)
+}
+
+// ValidateFile validates every catalog entity in the file. Every problem
+// found is returned. An error is returned only if the file can not be
+// read or is not valid yaml.
+func ValidateFile(path string) ([]Problem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %v", path, err)
+	}
+	return Validate(data)
+}
+
+// Validate validates each catalog entity in the yaml documents against
+// the Backstage descriptor format: the api version and kind, the
+// metadata naming rules, the required fields of the kind's spec and the
+// syntax of entity references. Entities must also be unique within the
+// file.
+func Validate(data []byte) ([]Problem, error) {
+	v := &validator{seen: map[string]bool{}}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	entities := 0
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal yaml: %v", err)
+		}
+		if len(doc.Content) == 0 || doc.Content[0].Tag == "!!null" {
+			continue
+		}
+		entities++
+		v.entity(doc.Content[0])
+	}
+	if entities == 0 {
+		v.problems = append(v.problems, Problem{Line: 1, Column: 1, Message: "file has no entities"})
+	}
+	return v.problems, nil
+}
+
+type validator struct {
+	problems []Problem
+	// seen holds the kind, namespace and name of each entity validated.
+	seen map[string]bool
+}
+
+func (v *validator) add(n *yaml.Node, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Line: n.Line, Column: n.Column, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) warn(n *yaml.Node, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Line: n.Line, Column: n.Column, Message: fmt.Sprintf(format, args...), Warning: true})
+}
+
+func (v *validator) entity(root *yaml.Node) {
+	if root.Kind != yaml.MappingNode {
+		v.add(root, "entity must be a mapping")
+		return
+	}
+
+	if n := v.requiredScalar(root, root, "apiVersion"); n != nil && !slices.Contains(apiVersions, n.Value) {
+		v.add(n, "apiVersion %q is not supported, expected one of %s", n.Value, strings.Join(apiVersions, ", "))
+	}
+
+	kind := v.requiredScalar(root, root, "kind")
+	if kind != nil {
+		if !SupportedKind(kind.Value) {
+			// Backstage has more kinds than goci knows, such as Domain
+			// and User, which are left to the catalog to validate.
+			v.warn(kind, "kind %q is not supported and is skipped, goci supports %s", kind.Value, strings.Join(supportedKinds(), ", "))
+			kind = nil
+		}
+	}
+
+	if key, metadata := keyValue(root, "metadata"); metadata == nil {
+		v.add(root, "metadata is required")
+	} else {
+		v.metadata(key, metadata)
+	}
+
+	if kind != nil {
+		v.spec(root, kind.Value)
+		v.unique(root, kind.Value)
+	}
+}
+
+// unique records a problem if an entity with the same kind, namespace
+// and name was already validated.
+func (v *validator) unique(root *yaml.Node, kind string) {
+	metadata := field(root, "metadata")
+	if metadata == nil || metadata.Kind != yaml.MappingNode {
+		return
+	}
+	name := field(metadata, "name")
+	if name == nil || name.Value == "" {
+		return
+	}
+	namespace := "default"
+	if n := field(metadata, "namespace"); n != nil && n.Value != "" {
+		namespace = n.Value
+	}
+	ref := fmt.Sprintf("%s:%s/%s", strings.ToLower(kind), namespace, name.Value)
+	if v.seen[ref] {
+		v.add(name, "%s is declared more than once", ref)
+	}
+	v.seen[ref] = true
+}
+
+func (v *validator) metadata(key, m *yaml.Node) {
+	if m.Kind != yaml.MappingNode {
+		v.add(m, "metadata must be a mapping")
+		return
+	}
+	if n := v.requiredScalar(key, m, "metadata.name"); n != nil {
+		v.name(n, "metadata.name", n.Value, namePattern)
+	}
+	if n := field(m, "namespace"); n != nil && v.scalar(n, "metadata.namespace") {
+		v.name(n, "metadata.namespace", n.Value, namespacePattern)
+	}
+	if tags := field(m, "tags"); tags != nil {
+		if tags.Kind != yaml.SequenceNode {
+			v.add(tags, "metadata.tags must be a list")
+			return
+		}
+		for _, n := range tags.Content {
+			if v.scalar(n, "metadata.tags") {
+				v.name(n, "metadata.tags", n.Value, tagPattern)
+			}
+		}
+	}
+}
+
+func (v *validator) spec(root *yaml.Node, kind string) {
+	specKey, spec := keyValue(root, "spec")
+	if spec == nil {
+		v.add(root, "spec is required for kind %s", kind)
+		return
+	}
+	if spec.Kind != yaml.MappingNode {
+		v.add(spec, "spec must be a mapping")
+		return
+	}
+
+	for _, f := range specFields[kind] {
+		key := "spec." + f.key
+		n := field(spec, f.key)
+		if n == nil {
+			if f.required {
+				v.add(specKey, "%s is required for kind %s", key, kind)
+			}
+			continue
+		}
+
+		values := []*yaml.Node{n}
+		if f.list {
+			if n.Kind != yaml.SequenceNode {
+				v.add(n, "%s must be a list", key)
+				continue
+			}
+			values = n.Content
+		}
+		for _, value := range values {
+			if !v.scalar(value, key) {
+				continue
+			}
+			if value.Value == "" && f.required && !f.list {
+				v.add(value, "%s must not be empty", key)
+				continue
+			}
+			if len(f.refKinds) > 0 {
+				v.ref(value, key, f)
+			}
+		}
+	}
+
+	if kind == KindLocation {
+		if field(spec, "target") == nil && field(spec, "targets") == nil {
+			v.add(specKey, "spec.target or spec.targets is required for kind %s", kind)
+		}
+		if n := field(spec, "type"); n != nil && n.Value != "file" && n.Value != "url" {
+			v.add(n, "spec.type %q is not supported, expected file or url", n.Value)
+		}
+	}
+}
+
+// ref validates the syntax of an entity reference, [kind:][namespace/]name.
+func (v *validator) ref(n *yaml.Node, key string, f specField) {
+	m := refPattern.FindStringSubmatch(n.Value)
+	if m == nil {
+		v.add(n, "%s %q is not a valid entity reference, expected [kind:][namespace/]name", key, n.Value)
+		return
+	}
+	kind, namespace, name := strings.ToLower(m[1]), m[2], m[3]
+	if kind == "" {
+		if f.defaultKind == "" {
+			v.add(n, "%s %q must include the kind, e.g. %s:%s", key, n.Value, f.refKinds[0], n.Value)
+			return
+		}
+	} else if !slices.Contains(f.refKinds, kind) {
+		v.add(n, "%s %q must refer to a %s", key, n.Value, strings.Join(f.refKinds, " or "))
+	}
+	if namespace != "" {
+		v.name(n, key+" namespace", namespace, namespacePattern)
+	}
+	v.name(n, key+" name", name, namePattern)
+}
+
+func (v *validator) name(n *yaml.Node, key, value string, pattern *regexp.Regexp) {
+	switch {
+	case value == "":
+		v.add(n, "%s must not be empty", key)
+	case len(value) > maxNameLength:
+		v.add(n, "%s %q is longer than %d characters", key, value, maxNameLength)
+	case !pattern.MatchString(value):
+		v.add(n, "%s %q must match %s", key, value, pattern)
+	}
+}
+
+// requiredScalar returns the scalar value of the key in the mapping,
+// recording a problem if it is missing, not a scalar or empty. A missing
+// key is reported at the position of at. The key may be qualified by
+// its parent for error messages.
+func (v *validator) requiredScalar(at, m *yaml.Node, key string) *yaml.Node {
+	short := key[strings.LastIndex(key, ".")+1:]
+	n := field(m, short)
+	if n == nil {
+		v.add(at, "%s is required", key)
+		return nil
+	}
+	if !v.scalar(n, key) {
+		return nil
+	}
+	if n.Value == "" {
+		v.add(n, "%s must not be empty", key)
+		return nil
+	}
+	return n
+}
+
+func (v *validator) scalar(n *yaml.Node, key string) bool {
+	if n.Kind != yaml.ScalarNode {
+		v.add(n, "%s must be a string", key)
+		return false
+	}
+	return true
+}
+
+// field returns the value of the key in the mapping node, or nil if it
+// is not set.
+func field(m *yaml.Node, key string) *yaml.Node {
+	_, value := keyValue(m, key)
+	return value
+}
+
+// keyValue returns the key and value nodes of the key in the mapping
+// node, or nils if it is not set.
+func keyValue(m *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i], m.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// SupportedKind returns true if entities of the kind are validated and
+// synced by goci.
+func SupportedKind(kind string) bool {
+	_, ok := specFields[kind]
+	return ok
+}
+
+func supportedKinds() []string {
+	kinds := make([]string, 0, len(specFields))
+	for k := range specFields {
+		kinds = append(kinds, k)
+	}
+	slices.Sort(kinds)
+	return kinds
+}
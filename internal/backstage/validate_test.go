@@ -0,0 +1,128 @@
+package backstage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateValid(t *testing.T) {
+	problems, err := Validate([]byte(`apiVersion: backstage.io/v1alpha1
+kind: Component
+metadata:
+  name: my-test-app
+  tags: [go, ci]
+spec:
+  type: service
+  lifecycle: production
+  owner: group:default/eng-infra
+  system: sso
+  providesApis: [my-test-api]
+  dependsOn: [resource:default/my-db]
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(problems) > 0 {
+		t.Errorf("expected no problems, got %v", problems)
+	}
+}
+
+func TestValidateProblems(t *testing.T) {
+	problems, err := Validate([]byte(`apiVersion: backstage.io/v1alpha1
+kind: Component
+metadata:
+  name: my_test app
+  tags: [Go]
+spec:
+  type: service
+  owner: team:eng-infra
+  dependsOn: [my-db]
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		`4:9: metadata.name "my_test app" must match`,
+		`5:10: metadata.tags "Go" must match`,
+		`6:1: spec.lifecycle is required for kind Component`,
+		`8:10: spec.owner "team:eng-infra" must refer to a group or user`,
+		`9:15: spec.dependsOn "my-db" must include the kind`,
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("expected %d problems, got %v", len(want), problems)
+	}
+	for i, p := range problems {
+		if !strings.HasPrefix(p.String(), want[i]) {
+			t.Errorf("expected problem %q, got %q", want[i], p.String())
+		}
+	}
+}
+
+func TestValidateKind(t *testing.T) {
+	problems, err := Validate([]byte(`apiVersion: backstage.io/v1alpha1
+kind: Service
+metadata:
+  name: my-test-app
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(problems) != 1 || !problems[0].Warning || !strings.HasPrefix(problems[0].String(), `2:7: warning: kind "Service" is not supported`) {
+		t.Errorf("expected an unsupported kind warning, got %v", problems)
+	}
+}
+
+func TestValidateMultipleDocuments(t *testing.T) {
+	problems, err := Validate([]byte(`apiVersion: backstage.io/v1alpha1
+kind: Component
+metadata:
+  name: my-test-app
+spec:
+  type: service
+  lifecycle: production
+  owner: eng-infra
+  providesApis: [my-test-api]
+---
+apiVersion: backstage.io/v1alpha1
+kind: API
+metadata:
+  name: my-test-api
+spec:
+  type: openapi
+  lifecycle: production
+  owner: eng-infra
+---
+apiVersion: backstage.io/v1alpha1
+kind: Location
+metadata:
+  name: my-test-apis
+spec:
+  targets: [./apis/*.yaml]
+---
+apiVersion: backstage.io/v1alpha1
+kind: Component
+metadata:
+  name: my-test-app
+spec:
+  type: service
+  lifecycle: production
+  owner: eng-infra
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		`15:1: spec.definition is required for kind API`,
+		`30:9: component:default/my-test-app is declared more than once`,
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("expected %d problems, got %v", len(want), problems)
+	}
+	for i, p := range problems {
+		if p.String() != want[i] {
+			t.Errorf("expected problem %q, got %q", want[i], p.String())
+		}
+	}
+}
@@ -3,13 +3,11 @@ package catapult
 import (
 	"context"
 	"fmt"
-	"net/http"
-	"strings"
-	"time"
 
+	"github.com/Clever/ci-scripts/internal/deploy"
 	"github.com/Clever/ci-scripts/internal/environment"
-	"github.com/Clever/ci-scripts/internal/logger"
-	"github.com/Clever/circle-ci-integrations/gen-go/client"
+	"github.com/Clever/ci-scripts/internal/integrations"
+	"github.com/Clever/ci-scripts/internal/retry"
 	"github.com/Clever/circle-ci-integrations/gen-go/models"
 
 	"golang.org/x/sync/errgroup"
@@ -23,48 +21,27 @@ type Artifact = models.CatapultApplication
 // Catapult wraps the circle-ci-integrations service with a trimmed down
 // and simplified API.
 type Catapult struct {
-	client client.Client
+	client *integrations.Client
 }
 
-// New initializes Catapult with a circle-ci-integrations client that
-// handles basic auth and discovers it's url via ci environment variables.
-func New() *Catapult {
-	// circle-ci-integrations up until this app was requested against in
-	// ci via curl. Because of this the url environment variable was the
-	// full protocol, hostname and path. This cleans up the variable so
-	// we only have the proto and hostname. There are two separate
-	// variables provided to provide legacy support so clean up both
-	// possibilities
-	url := strings.TrimSuffix(environment.CatapultURL(), "/v2/catapult")
-	url = strings.TrimSuffix(url, "/catapult")
-	var rt http.RoundTripper = &basicAuthTransport{}
-	cli := client.New(url, logger.FmtPrinlnLogger{}, &rt)
-	cli.SetTimeout(15 * time.Second)
-	return &Catapult{client: cli}
+// New initializes Catapult with a circle-ci-integrations client.
+func New(client *integrations.Client) *Catapult {
+	return &Catapult{client: client}
 }
 
-// SyncCatalogEntity syncs passed in entity to catalog-config by calling circle-ci-integrations
-func (c *Catapult) SyncCatalogEntity(ctx context.Context, entity *models.SyncCatalogEntityInput) error {
-	branch := environment.Branch()
-	dryRun := branch != "master"
-	entity.Branch = &branch
-	entity.DryRun = &dryRun
-	fmt.Printf("Syncing catalog entity %s with type %s on branch %s with dry run %t\n", entity.Entity, entity.Type, branch, dryRun)
-	err := c.client.SyncCatalogEntity(ctx, entity)
-	if err != nil {
-		return fmt.Errorf("failed to sync catalog entity %s with catalogue config: %v", entity.Entity, err)
-	}
-	return nil
-}
-
-// Publish a list of build artifacts to catapult.
-func (c *Catapult) Publish(ctx context.Context, artifacts []*Artifact) error {
+// Publish a list of build artifacts to catapult, syncing each app's
+// catalog entity. Sync failures are recorded in the report rather than
+// failing the publish.
+func (c *Catapult) Publish(ctx context.Context, artifacts []*Artifact, syncs *integrations.SyncReport) error {
 	grp, grpCtx := errgroup.WithContext(ctx)
 
 	for _, art := range artifacts {
 		grp.Go(func() error {
 			fmt.Println("Publishing", art.ID)
-			err := c.client.PostCatapultV2(grpCtx, &models.CatapultPublishRequest{
+			// Publishing the same build of an app twice must be safe to
+			// retry, so the request carries a key unique to the build.
+			pubCtx := retry.WithIdempotencyKey(grpCtx, publishIdempotencyKey(art.ID))
+			err := c.client.PostCatapultV2(pubCtx, &models.CatapultPublishRequest{
 				Username: environment.CircleUser(),
 				Reponame: environment.Repo(),
 				Buildnum: environment.CircleBuildNum(),
@@ -75,45 +52,83 @@ func (c *Catapult) Publish(ctx context.Context, artifacts []*Artifact) error {
 			}
 
 			repo := environment.Repo()
-			err = c.SyncCatalogEntity(grpCtx, &models.SyncCatalogEntityInput{
+			syncs.Record(art.ID, c.client.SyncCatalogEntity(grpCtx, &models.SyncCatalogEntityInput{
 				Entity: art.ID,
 				Type:   "application",
 				Repo:   &repo,
-			})
-			if err != nil {
-				fmt.Println("failed to sync catalog app", art.ID, "with catalogue config:", err)
-			}
+			}))
 			return nil
 		})
 	}
 	return grp.Wait()
 }
 
-// Deploy a list of apps via catapult. Note that it is only possible to
-// deploy to production, even if you pass an env param to
-// circle-ci-integrations, which seems to ignore the param.
-func (c *Catapult) Deploy(ctx context.Context, apps []string) error {
-	for _, app := range apps {
-		fmt.Println("Deploying", app)
-		err := c.client.PostDapple(ctx, &models.DeployRequest{
-			Appname:  app,
-			Buildnum: environment.CircleBuildNum(),
-			Reponame: environment.Repo(),
-			Username: environment.CircleUser(),
-		})
-		if err != nil {
-			return fmt.Errorf("failed to deploy %s: %v", app, err)
+// Deployment strategies supported by catapult. An empty strategy uses
+// catapult's default.
+const (
+	StrategyConfirmThenDeploy = "confirm-then-deploy"
+	StrategyNoConfirmDeploy   = "no-confirm-deploy"
+)
+
+// ValidateStrategy returns an error if the strategy is not one catapult
+// supports.
+func ValidateStrategy(strategy string) error {
+	switch strategy {
+	case "", StrategyConfirmThenDeploy, StrategyNoConfirmDeploy:
+		return nil
+	default:
+		return fmt.Errorf("unknown deployment strategy %q, expected %s or %s", strategy, StrategyConfirmThenDeploy, StrategyNoConfirmDeploy)
+	}
+}
+
+// Deploy an app via catapult to the target environment with the target
+// deployment strategy.
+func (c *Catapult) Deploy(ctx context.Context, t deploy.Target) error {
+	if err := ValidateStrategy(t.Strategy); err != nil {
+		return err
+	}
+
+	fmt.Println("Deploying", t, "with strategy", orDefault(t.Strategy))
+	req := &models.DeployRequest{
+		Appname:  t.App,
+		Buildnum: environment.CircleBuildNum(),
+		Reponame: environment.Repo(),
+		Username: environment.CircleUser(),
+	}
+	if t.Environment != "" {
+		req.Environment = &t.Environment
+	}
+	if t.Strategy != "" {
+		req.Strategy = &t.Strategy
+	}
+
+	// A retried deploy must not start a second rollout, so the request
+	// carries a key unique to the target and build.
+	ctx = retry.WithIdempotencyKey(ctx, deployIdempotencyKey(t))
+	if err := c.client.PostDapple(ctx, req); err != nil {
+		if t.Environment != "" || t.Strategy != "" {
+			return fmt.Errorf("catapult rejected deploy of %s with strategy %s: %v", t, orDefault(t.Strategy), err)
 		}
+		return fmt.Errorf("failed to deploy %s: %v", t.App, err)
 	}
 	return nil
 }
 
-// Wraps the default http transport in a very thin wrapper which just
-// adds basic auth to all of the requests. The auth params are pulled
-// from the ci environment.
-type basicAuthTransport struct{}
+func orDefault(s string) string {
+	if s == "" {
+		return "default"
+	}
+	return s
+}
+
+// publishIdempotencyKey identifies the publish of an app for the current
+// build.
+func publishIdempotencyKey(app string) string {
+	return fmt.Sprintf("%s/%s/%d", environment.Repo(), app, environment.CircleBuildNum())
+}
 
-func (ba *basicAuthTransport) RoundTrip(r *http.Request) (*http.Response, error) {
-	r.SetBasicAuth(environment.CatapultUser(), environment.CatapultPassword())
-	return http.DefaultTransport.RoundTrip(r)
+// deployIdempotencyKey identifies the deploy of the target for the
+// current build.
+func deployIdempotencyKey(t deploy.Target) string {
+	return fmt.Sprintf("%s/%s/%s/%d/deploy", environment.Repo(), t.App, orDefault(t.Environment), environment.CircleBuildNum())
 }
@@ -0,0 +1,183 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Approval is the decision on a deploy to a gated environment.
+type Approval struct {
+	Approved bool
+	// Approver is the GitHub username of whoever made the decision, and
+	// Email their email address, if known.
+	Approver string
+	Email    string
+	// Reason optionally explains the decision.
+	Reason string
+}
+
+// Approver creates approvals for deploys and reports their decisions.
+// Approvers may be a CI hold job, an external service or a file.
+type Approver interface {
+	// Request creates a pending approval of the deploy, returning an ID
+	// to check it with.
+	Request(ctx context.Context, t Target) (string, error)
+	// Check returns the decision on the approval, or nil while it is
+	// still pending.
+	Check(ctx context.Context, t Target, id string) (*Approval, error)
+}
+
+// Gate holds deploys to gated environments until they are approved.
+type Gate struct {
+	Approver Approver
+	// Environments are the gated environments.
+	Environments []string
+	Interval     time.Duration
+	Timeout      time.Duration
+	// Allow, if set, is checked once a deploy is approved, since the
+	// wait may have crossed into a freeze window or out of the deploy's
+	// schedule. The deploy fails if it returns an error.
+	Allow func(Target) error
+}
+
+// Gated returns true if deploys to the environment must be approved.
+func (g *Gate) Gated(env string) bool {
+	for _, e := range g.Environments {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
+
+// Wait requests approval of the deploy and polls the approver until it
+// is decided or the timeout passes. An error is returned unless the
+// deploy was approved.
+func (g *Gate) Wait(ctx context.Context, t Target) (Approval, error) {
+	ctx, cancel := context.WithTimeout(ctx, g.Timeout)
+	defer cancel()
+
+	id, err := g.Approver.Request(ctx, t)
+	if err != nil {
+		return Approval{}, fmt.Errorf("failed to request approval of deploy of %s: %v", t, err)
+	}
+	fmt.Println("Waiting up to", g.Timeout, "for approval of deploy of", t, "("+id+")")
+
+	ticker := time.NewTicker(g.Interval)
+	defer ticker.Stop()
+	for {
+		a, err := g.Approver.Check(ctx, t, id)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			// The approver may be temporarily unavailable, so keep
+			// polling until the timeout.
+			fmt.Printf("failed to check approval of deploy of %s: %v\n", t, err)
+		case a != nil && a.Approved:
+			fmt.Printf("deploy of %s approved by %s\n", t, a.Approver)
+			if g.Allow != nil {
+				if err := g.Allow(t); err != nil {
+					return *a, fmt.Errorf("deploy of %s was approved but is no longer allowed: %v", t, err)
+				}
+			}
+			return *a, nil
+		case a != nil:
+			return *a, fmt.Errorf("deploy of %s was rejected by %s%s", t, a.Approver, reason(a.Reason))
+		}
+
+		select {
+		case <-ctx.Done():
+			return Approval{}, fmt.Errorf("timed out waiting for approval of deploy of %s", t)
+		case <-ticker.C:
+		}
+	}
+}
+
+func reason(r string) string {
+	if r == "" {
+		return ""
+	}
+	return ": " + r
+}
+
+// FileApprover keeps approvals as JSON files in Dir, named after the
+// app and environment, for tests and local runs. A request writes a
+// pending approval which is decided by editing its state to approved or
+// rejected.
+type FileApprover struct {
+	Dir string
+}
+
+// approvalRecord is an approval as kept by the FileApprover and served
+// by the HTTPApprover.
+type approvalRecord struct {
+	// ID identifies the approval to the HTTPApprover.
+	ID          string `json:"id,omitempty"`
+	App         string `json:"app"`
+	Environment string `json:"environment"`
+	Revision    string `json:"revision"`
+	// State is pending, approved or rejected.
+	State    string `json:"state"`
+	Approver string `json:"approver,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+func (f *FileApprover) Request(ctx context.Context, t Target) (string, error) {
+	path := filepath.Join(f.Dir, fmt.Sprintf("%s-%s.json", t.App, orDefault(t.Environment)))
+	if bs, err := os.ReadFile(path); err == nil {
+		// An existing approval of the same revision is kept so that it
+		// may be decided ahead of the deploy. One of any other revision
+		// is replaced.
+		var a approvalRecord
+		if json.Unmarshal(bs, &a) == nil && a.Revision == t.Revision {
+			return path, nil
+		}
+		fmt.Printf("replacing approval file %s, which is not for revision %s\n", path, t.Revision)
+	}
+	bs, err := json.MarshalIndent(approvalRecord{
+		App:         t.App,
+		Environment: t.Environment,
+		Revision:    t.Revision,
+		State:       "pending",
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, bs, 0o644)
+}
+
+func (f *FileApprover) Check(ctx context.Context, t Target, id string) (*Approval, error) {
+	bs, err := os.ReadFile(id)
+	if err != nil {
+		return nil, err
+	}
+	var a approvalRecord
+	if err := json.Unmarshal(bs, &a); err != nil {
+		return nil, fmt.Errorf("invalid approval file %s: %v", id, err)
+	}
+	if a.Revision != t.Revision {
+		return nil, fmt.Errorf("approval file %s is for revision %q, not %s", id, a.Revision, t.Revision)
+	}
+	return a.decision()
+}
+
+// decision returns the Approval of a decided record, or nil while it is
+// pending.
+func (a approvalRecord) decision() (*Approval, error) {
+	switch a.State {
+	case "pending":
+		return nil, nil
+	case "approved", "rejected":
+		return &Approval{Approved: a.State == "approved", Approver: a.Approver, Email: a.Email, Reason: a.Reason}, nil
+	default:
+		return nil, errors.New("approval state must be pending, approved or rejected, got " + a.State)
+	}
+}
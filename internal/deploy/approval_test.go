@@ -0,0 +1,110 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGateWaitFileApprover(t *testing.T) {
+	dir := t.TempDir()
+	g := &Gate{
+		Approver:     &FileApprover{Dir: dir},
+		Environments: []string{"production"},
+		Interval:     time.Millisecond,
+		Timeout:      200 * time.Millisecond,
+	}
+	if g.Gated("clever-dev") || !g.Gated("production") {
+		t.Fatal("expected only production to be gated")
+	}
+
+	// Decisions made ahead of the deploy are kept, unless they are for
+	// another revision.
+	decide := func(app, revision, state string) {
+		bs, _ := json.Marshal(approvalRecord{App: app, Environment: "production", Revision: revision, State: state, Approver: "octocat", Email: "octocat@example.com", Reason: "not today"})
+		if err := os.WriteFile(filepath.Join(dir, app+"-production.json"), bs, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	decide("approved-app", "abc1234", "approved")
+	decide("rejected-app", "abc1234", "rejected")
+	decide("stale-app", "0000000", "approved")
+
+	tests := []struct {
+		app     string
+		want    Approval
+		wantErr string
+	}{
+		{app: "approved-app", want: Approval{Approved: true, Approver: "octocat", Email: "octocat@example.com", Reason: "not today"}},
+		{app: "rejected-app", wantErr: "deploy of rejected-app to production was rejected by octocat: not today"},
+		{app: "pending-app", wantErr: "timed out waiting for approval of deploy of pending-app to production"},
+		{app: "stale-app", wantErr: "timed out waiting for approval of deploy of stale-app to production"},
+	}
+	for _, tc := range tests {
+		a, err := g.Wait(context.Background(), Target{App: tc.app, Environment: "production", Revision: "abc1234"})
+		if tc.wantErr != "" {
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("%s: expected error %q, got %v", tc.app, tc.wantErr, err)
+			}
+			continue
+		}
+		if err != nil || a != tc.want {
+			t.Errorf("%s: expected %+v, got %+v, %v", tc.app, tc.want, a, err)
+		}
+	}
+
+	// Pending approvals are written for whoever decides them.
+	bs, err := os.ReadFile(filepath.Join(dir, "pending-app-production.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bs), `"state": "pending"`) {
+		t.Errorf("unexpected pending approval %s", bs)
+	}
+}
+
+func TestHTTPApprover(t *testing.T) {
+	polls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("unexpected authorization %q", r.Header.Get("Authorization"))
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/approvals":
+			var a approvalRecord
+			if err := json.NewDecoder(r.Body).Decode(&a); err != nil || a.App != "my-app" || a.Revision != "abc1234" {
+				t.Errorf("unexpected approval request %+v, %v", a, err)
+			}
+			json.NewEncoder(w).Encode(approvalRecord{ID: "42", State: "pending"})
+		case r.Method == http.MethodGet && r.URL.Path == "/approvals/42":
+			polls++
+			if polls < 3 {
+				json.NewEncoder(w).Encode(approvalRecord{ID: "42", State: "pending"})
+				return
+			}
+			json.NewEncoder(w).Encode(approvalRecord{ID: "42", State: "approved", Approver: "octocat"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	g := &Gate{
+		Approver: &HTTPApprover{URL: srv.URL + "/approvals", Token: "secret"},
+		Interval: time.Millisecond,
+		Timeout:  time.Second,
+	}
+	a, err := g.Wait(context.Background(), Target{App: "my-app", Environment: "production", Revision: "abc1234"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.Approved || a.Approver != "octocat" || polls != 3 {
+		t.Errorf("unexpected approval %+v after %d polls", a, polls)
+	}
+}
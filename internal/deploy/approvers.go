@@ -0,0 +1,160 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HTTPApprover requests approvals from an external service, in the
+// style of GitHub deployment protection rules. A request is a POST to
+// URL with the app, environment and revision, which responds with the
+// approval's id. The approval is then polled with a GET to URL/<id>,
+// which responds with its state of pending, approved or rejected, and
+// the approver once decided.
+type HTTPApprover struct {
+	URL string
+	// Token is sent as a bearer token if set.
+	Token  string
+	Client *http.Client
+}
+
+func (h *HTTPApprover) Request(ctx context.Context, t Target) (string, error) {
+	body, err := json.Marshal(approvalRecord{App: t.App, Environment: t.Environment, Revision: t.Revision})
+	if err != nil {
+		return "", err
+	}
+	var a approvalRecord
+	if err := h.do(ctx, http.MethodPost, h.URL, bytes.NewReader(body), &a); err != nil {
+		return "", err
+	}
+	if a.ID == "" {
+		return "", errors.New("approval endpoint responded without an approval id")
+	}
+	return a.ID, nil
+}
+
+func (h *HTTPApprover) Check(ctx context.Context, t Target, id string) (*Approval, error) {
+	var a approvalRecord
+	if err := h.do(ctx, http.MethodGet, strings.TrimSuffix(h.URL, "/")+"/"+url.PathEscape(id), nil, &a); err != nil {
+		return nil, err
+	}
+	return a.decision()
+}
+
+func (h *HTTPApprover) do(ctx context.Context, method, u string, body io.Reader, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if h.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.Token)
+	}
+	return doJSON(h.Client, req, out)
+}
+
+// CircleCIApprover gates deploys on approval jobs in the CircleCI
+// workflow running goci. The workflow must have an approval job for each
+// gated deploy, named by Job in which {app} and {environment} are
+// replaced with the target's. The deploy is approved once the job is,
+// and rejected if the job is cancelled.
+type CircleCIApprover struct {
+	// APIURL is the CircleCI v2 API, https://circleci.com/api/v2.
+	APIURL     string
+	Token      string
+	WorkflowID string
+	Job        string
+	Client     *http.Client
+}
+
+// circleJob is a job of the CircleCI workflow job list.
+type circleJob struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Status     string `json:"status"`
+	ApprovedBy string `json:"approved_by"`
+}
+
+func (c *CircleCIApprover) Request(ctx context.Context, t Target) (string, error) {
+	name := strings.NewReplacer("{app}", t.App, "{environment}", t.Environment).Replace(c.Job)
+	// The approval job already exists in the workflow, so requesting
+	// approval only checks that it does.
+	if _, err := c.job(ctx, name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func (c *CircleCIApprover) Check(ctx context.Context, t Target, id string) (*Approval, error) {
+	job, err := c.job(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	switch job.Status {
+	case "on_hold", "blocked", "not_running":
+		return nil, nil
+	case "success":
+		var user struct {
+			Login string `json:"login"`
+		}
+		if err := c.get(ctx, "/user/"+url.PathEscape(job.ApprovedBy), &user); err != nil {
+			return nil, fmt.Errorf("failed to get approver of %s: %v", id, err)
+		}
+		return &Approval{Approved: true, Approver: user.Login}, nil
+	default:
+		return &Approval{Approver: "circleci", Reason: fmt.Sprintf("approval job %s is %s", id, job.Status)}, nil
+	}
+}
+
+func (c *CircleCIApprover) job(ctx context.Context, name string) (circleJob, error) {
+	var jobs struct {
+		Items []circleJob `json:"items"`
+	}
+	if err := c.get(ctx, "/workflow/"+url.PathEscape(c.WorkflowID)+"/job", &jobs); err != nil {
+		return circleJob{}, err
+	}
+	for _, j := range jobs.Items {
+		if j.Name == name && j.Type == "approval" {
+			return j, nil
+		}
+	}
+	return circleJob{}, fmt.Errorf("workflow %s has no approval job %s", c.WorkflowID, name)
+}
+
+func (c *CircleCIApprover) get(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.APIURL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Circle-Token", c.Token)
+	return doJSON(c.Client, req, out)
+}
+
+// doJSON sends the request and decodes the JSON response into out. Any
+// response other than a 2xx is an error.
+func doJSON(cli *http.Client, req *http.Request, out any) error {
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s %s responded %s", req.Method, req.URL.Redacted(), resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response of %s %s: %v", req.Method, req.URL.Redacted(), err)
+	}
+	return nil
+}
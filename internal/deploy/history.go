@@ -0,0 +1,182 @@
+package deploy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Clever/ci-scripts/internal/repo"
+)
+
+// Deployment is a successful deploy of a revision of an app.
+type Deployment struct {
+	App         string    `json:"app"`
+	Environment string    `json:"environment"`
+	Revision    string    `json:"revision"`
+	Time        time.Time `json:"time"`
+	// RollbackOf is the revision this deploy rolled back, if it was a
+	// rollback.
+	RollbackOf string `json:"rollbackOf,omitempty"`
+	// Overrides are the deploy overrides the revision was deployed with,
+	// so that a rollback deploys it the same way. They are always
+	// recorded, so nil means the deploy was recorded before they were.
+	Overrides *repo.DeployOverrides `json:"overrides,omitempty"`
+}
+
+// History provides the past deploys of apps. Providers may read a local
+// file or a deploy system's API.
+type History interface {
+	// Deployments returns the successful deploys of the app to the
+	// environment, most recent first.
+	Deployments(ctx context.Context, app, env string) ([]Deployment, error)
+}
+
+// PreviousRevision returns the most recent deploy of the app to the
+// environment before its current revision, skipping any revision which
+// has been rolled back since it is known to be bad.
+func PreviousRevision(ctx context.Context, h History, app, env string) (current string, previous Deployment, err error) {
+	deployments, err := h.Deployments(ctx, app, env)
+	if err != nil {
+		return "", Deployment{}, fmt.Errorf("failed to read deploy history of %s to %s: %v", app, orDefault(env), err)
+	}
+	if len(deployments) == 0 {
+		return "", Deployment{}, fmt.Errorf("no deploys of %s to %s in the deploy history", app, orDefault(env))
+	}
+	current = deployments[0].Revision
+	bad := map[string]bool{current: true}
+	for _, d := range deployments {
+		if d.RollbackOf != "" {
+			bad[d.RollbackOf] = true
+		}
+	}
+	for _, d := range deployments[1:] {
+		if !bad[d.Revision] {
+			return current, d, nil
+		}
+	}
+	return "", Deployment{}, fmt.Errorf("no deploy of %s to %s before %s to roll back to", app, orDefault(env), current)
+}
+
+// FileHistory keeps the deploy history in a JSONL file, one Deployment
+// per line in the order they were deployed.
+type FileHistory struct {
+	Path string
+}
+
+func (f *FileHistory) Deployments(ctx context.Context, app, env string) ([]Deployment, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	var out []Deployment
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		var d Deployment
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil {
+			return nil, fmt.Errorf("invalid deploy history %s line %d: %v", f.Path, line, err)
+		}
+		if d.App == app && d.Environment == env {
+			out = append([]Deployment{d}, out...)
+		}
+	}
+	return out, scanner.Err()
+}
+
+// Record appends the deploys to the history.
+func (f *FileHistory) Record(deployments []Deployment) error {
+	if len(deployments) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(file)
+	for _, d := range deployments {
+		if err := enc.Encode(d); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
+
+// Record adds the deploys in the summary which succeeded to the history,
+// if it is a FileHistory. Other providers record deploys themselves. The
+// deployments are index-aligned with the summary's results, and their
+// time is set when recorded.
+func Record(h History, deployments []Deployment, s *Summary) error {
+	f, ok := h.(*FileHistory)
+	if !ok {
+		return nil
+	}
+	var out []Deployment
+	for i, r := range s.Results {
+		if r.Outcome != OutcomeDeployed {
+			continue
+		}
+		d := deployments[i]
+		d.Time = time.Now().UTC()
+		if d.Overrides == nil {
+			d.Overrides = &repo.DeployOverrides{}
+		}
+		out = append(out, d)
+	}
+	return f.Record(out)
+}
+
+// HTTPHistory reads the deploy history from an endpoint. Each request is
+// a GET to URL with app and environment query parameters, which responds
+// with {"deployments": [...]}, most recent first.
+type HTTPHistory struct {
+	URL string
+	// Token is sent as a bearer token if set.
+	Token  string
+	Client *http.Client
+}
+
+func (h *HTTPHistory) Deployments(ctx context.Context, app, env string) ([]Deployment, error) {
+	u, err := url.Parse(h.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deploy history url: %v", err)
+	}
+	q := u.Query()
+	q.Set("app", app)
+	q.Set("environment", env)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if h.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.Token)
+	}
+	var out struct {
+		Deployments []Deployment `json:"deployments"`
+	}
+	if err := doJSON(h.Client, req, &out); err != nil {
+		return nil, err
+	}
+	for _, d := range out.Deployments {
+		if d.Revision == "" {
+			return nil, errors.New("deploy history has a deploy without a revision")
+		}
+	}
+	return out.Deployments, nil
+}
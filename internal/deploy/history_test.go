@@ -0,0 +1,68 @@
+package deploy
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Clever/ci-scripts/internal/repo"
+)
+
+func TestPreviousRevision(t *testing.T) {
+	ctx := context.Background()
+	h := &FileHistory{Path: filepath.Join(t.TempDir(), "history.jsonl")}
+	record := func(revision, rollbackOf string, outcome Outcome) {
+		deployments := []Deployment{
+			{App: "my-app", Environment: "production", Revision: revision, RollbackOf: rollbackOf, Overrides: &repo.DeployOverrides{Env: map[string]string{"REVISION": revision}}},
+			{App: "other-app", Environment: "production", Revision: "other"},
+		}
+		s := &Summary{Results: []Result{
+			{App: "my-app", Environment: "production", Outcome: outcome},
+			{App: "other-app", Environment: "production", Outcome: OutcomeDeployed},
+		}}
+		if err := Record(h, deployments, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, _, err := PreviousRevision(ctx, h, "my-app", "production"); err == nil || !strings.Contains(err.Error(), "no deploys of my-app to production") {
+		t.Errorf("expected an error without history, got %v", err)
+	}
+
+	record("aaaaaaa", "", OutcomeDeployed)
+	record("bbbbbbb", "", OutcomeDeployed)
+	record("ccccccc", "", OutcomeFailed)
+	record("ddddddd", "", OutcomeDeployed)
+
+	current, previous, err := PreviousRevision(ctx, h, "my-app", "production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != "ddddddd" || previous.Revision != "bbbbbbb" {
+		t.Errorf("expected rollback from ddddddd to bbbbbbb, got %s to %s", current, previous.Revision)
+	}
+	// Rollbacks redeploy with the overrides the revision was deployed with.
+	if previous.Overrides == nil || previous.Overrides.Env["REVISION"] != "bbbbbbb" {
+		t.Errorf("expected the overrides of bbbbbbb, got %+v", previous.Overrides)
+	}
+	other, err := h.Deployments(ctx, "other-app", "production")
+	if err != nil || len(other) == 0 || other[0].Overrides == nil {
+		t.Errorf("expected deploys without overrides to record empty overrides, got %+v, %v", other, err)
+	}
+
+	// Once rolled back, the bad revision is never rolled back to.
+	record("bbbbbbb", "ddddddd", OutcomeDeployed)
+	current, previous, err = PreviousRevision(ctx, h, "my-app", "production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current != "bbbbbbb" || previous.Revision != "aaaaaaa" {
+		t.Errorf("expected rollback from bbbbbbb to aaaaaaa, got %s to %s", current, previous.Revision)
+	}
+
+	record("aaaaaaa", "bbbbbbb", OutcomeDeployed)
+	if _, _, err := PreviousRevision(ctx, h, "my-app", "production"); err == nil || !strings.Contains(err.Error(), "no deploy of my-app to production before aaaaaaa") {
+		t.Errorf("expected no revision to roll back to, got %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package deploy
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Waves groups the targets into waves which are deployed in order, as
+// indexes into targets. Every target is placed in a later wave than the
+// targets of the apps it is deployed after, directly or through apps
+// which are not being deployed. deployAfter maps an app to the apps it
+// must be deployed after, and should hold every app in the repo so that
+// any cycle is found, not just one among the apps being deployed. An
+// error is returned if the dependencies contain a cycle.
+func Waves(targets []Target, deployAfter map[string][]string) ([][]int, error) {
+	present := map[string]bool{}
+	for _, t := range targets {
+		present[t.App] = true
+	}
+
+	// The depth of an app is the number of apps being deployed on the
+	// longest chain of prerequisites below it.
+	const visiting = -1
+	depth := map[string]int{}
+	var visit func(app string, path []string) (int, error)
+	visit = func(app string, path []string) (int, error) {
+		if d, ok := depth[app]; ok {
+			if d == visiting {
+				cycle := append(path[slices.Index(path, app):], app)
+				return 0, fmt.Errorf("deployAfter has a cycle: %s", strings.Join(cycle, " -> "))
+			}
+			return d, nil
+		}
+		depth[app] = visiting
+		path = append(path, app)
+
+		d := 0
+		for _, dep := range deployAfter[app] {
+			dd, err := visit(dep, path)
+			if err != nil {
+				return 0, err
+			}
+			if present[dep] {
+				dd++
+			}
+			d = max(d, dd)
+		}
+		depth[app] = d
+		return d, nil
+	}
+
+	apps := make([]string, 0, len(present)+len(deployAfter))
+	for app := range present {
+		apps = append(apps, app)
+	}
+	for app := range deployAfter {
+		if !present[app] {
+			apps = append(apps, app)
+		}
+	}
+	sort.Strings(apps)
+	last := 0
+	for _, app := range apps {
+		d, err := visit(app, nil)
+		if err != nil {
+			return nil, err
+		}
+		if present[app] {
+			last = max(last, d)
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, nil
+	}
+	waves := make([][]int, last+1)
+	for i, t := range targets {
+		waves[depth[t.App]] = append(waves[depth[t.App]], i)
+	}
+	return waves, nil
+}
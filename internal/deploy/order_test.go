@@ -0,0 +1,68 @@
+package deploy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWaves(t *testing.T) {
+	targets := []Target{
+		{App: "sso-my-test-app"},
+		{App: "my-test-app"},
+		{App: "migrations"},
+		{App: "worker"},
+	}
+	deployAfter := map[string][]string{
+		"sso-my-test-app": {"my-test-app"},
+		"my-test-app":     {"migrations"},
+		"worker":          {"not-deployed"},
+	}
+	waves, err := Waves(targets, deployAfter)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := [][]int{{2, 3}, {1}, {0}}
+	if !reflect.DeepEqual(waves, want) {
+		t.Errorf("expected waves %v, got %v", want, waves)
+	}
+}
+
+func TestWavesCycle(t *testing.T) {
+	targets := []Target{{App: "a"}, {App: "b"}, {App: "c"}}
+	_, err := Waves(targets, map[string][]string{
+		"a": {"b"},
+		"b": {"c"},
+		"c": {"a"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "a -> b -> c -> a") {
+		t.Errorf("expected cycle error, got %v", err)
+	}
+}
+
+func TestWavesThroughAppsNotDeployed(t *testing.T) {
+	targets := []Target{{App: "frontend"}, {App: "migrations"}}
+	deployAfter := map[string][]string{
+		"frontend": {"api"},
+		"api":      {"migrations"},
+	}
+	waves, err := Waves(targets, deployAfter)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := [][]int{{1}, {0}}
+	if !reflect.DeepEqual(waves, want) {
+		t.Errorf("expected waves %v, got %v", want, waves)
+	}
+}
+
+func TestWavesCycleAmongAppsNotDeployed(t *testing.T) {
+	targets := []Target{{App: "a"}}
+	_, err := Waves(targets, map[string][]string{
+		"b": {"c"},
+		"c": {"b"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "b -> c -> b") {
+		t.Errorf("expected cycle error, got %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// Outcome is the final result of a single deploy.
+type Outcome string
+
+const (
+	OutcomeDeployed Outcome = "deployed"
+	OutcomeSkipped  Outcome = "skipped"
+	OutcomeFailed   Outcome = "failed"
+)
+
+// Result is the outcome of deploying a target.
+type Result struct {
+	App         string  `json:"app"`
+	Environment string  `json:"environment"`
+	Outcome     Outcome `json:"result"`
+	Reason      string  `json:"reason,omitempty"`
+}
+
+// Summary holds the result of every deploy in a run, in the order the
+// targets were given.
+type Summary struct {
+	Results []Result `json:"results"`
+}
+
+// Runner deploys targets concurrently, in waves ordered by their
+// dependencies.
+type Runner struct {
+	// Concurrency is the maximum number of deploys in flight. Values
+	// below one deploy sequentially.
+	Concurrency int
+	// KeepGoing continues starting deploys after one fails. Otherwise
+	// any deploys not yet started are skipped.
+	KeepGoing bool
+	// DeployAfter maps an app to the apps it must be deployed after. An
+	// app is only deployed once all of its prerequisites in the run have
+	// been deployed, and is skipped if any of them were not. Apps which
+	// are not in the run pass on their own prerequisites.
+	DeployAfter map[string][]string
+	// Wait, if set, is called with the targets deployed in each wave
+	// and blocks until they have rolled out. It returns an error for
+	// each target which did not roll out, index-aligned with targets.
+	// The next wave is only started once Wait returns.
+	Wait func(ctx context.Context, targets []Target) []error
+	// Approve, if set, is called for each target Gated returns true for
+	// and blocks until the deploy is approved, returning an error if it
+	// was not. Gated targets are deployed in batches of their own once
+	// approved, so that waiting for approval never holds up other
+	// deploys.
+	Gated   func(Target) bool
+	Approve func(ctx context.Context, t Target) error
+}
+
+// Run calls deploy for each of the targets and summarizes the results.
+// Deploys already in flight when another fails are always allowed to
+// finish. An error is returned without deploying anything if the
+// dependencies between the targets contain a cycle.
+func (r Runner) Run(ctx context.Context, targets []Target, deploy func(context.Context, Target) error) (*Summary, error) {
+	return r.RunBatches(ctx, targets, 1, func(ctx context.Context, batch []Target) []error {
+		return []error{deploy(ctx, batch[0])}
+	})
+}
+
+// RunBatches is Run for deploys which are made in batches of up to
+// batchSize targets of the same wave. Each batch counts once towards the
+// concurrency limit. deploy returns an error for each target which
+// failed, index-aligned with the batch.
+func (r Runner) RunBatches(ctx context.Context, targets []Target, batchSize int, deploy func(context.Context, []Target) []error) (*Summary, error) {
+	waves, err := Waves(targets, r.DeployAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Summary{Results: make([]Result, len(targets))}
+	for i, t := range targets {
+		s.Results[i] = Result{App: t.App, Environment: t.Environment}
+	}
+	for _, wave := range waves {
+		r.runWave(ctx, s, targets, wave, max(batchSize, 1), deploy)
+		if r.Wait == nil {
+			continue
+		}
+
+		var deployed []int
+		for _, i := range wave {
+			if s.Results[i].Outcome == OutcomeDeployed {
+				deployed = append(deployed, i)
+			}
+		}
+		if len(deployed) == 0 {
+			continue
+		}
+		waitTargets := make([]Target, len(deployed))
+		for n, i := range deployed {
+			waitTargets[n] = targets[i]
+		}
+		for n, err := range r.Wait(ctx, waitTargets) {
+			if err != nil {
+				s.Results[deployed[n]].Outcome = OutcomeFailed
+				s.Results[deployed[n]].Reason = err.Error()
+			}
+		}
+	}
+	return s, nil
+}
+
+// runWave deploys the targets of a single wave.
+func (r Runner) runWave(ctx context.Context, s *Summary, targets []Target, wave []int, batchSize int, deploy func(context.Context, []Target) []error) {
+	var ready []int
+	for _, i := range wave {
+		if dep := s.unmetPrerequisite(r.DeployAfter, targets[i].App, targets[i].Environment); dep != "" {
+			s.Results[i].Outcome = OutcomeSkipped
+			s.Results[i].Reason = fmt.Sprintf("prerequisite %s was not deployed", dep)
+			continue
+		}
+		ready = append(ready, i)
+	}
+
+	var (
+		sem       = make(chan struct{}, max(r.Concurrency, 1))
+		deploys   sync.WaitGroup
+		approvals sync.WaitGroup
+		mu        sync.Mutex
+	)
+	// dispatch deploys the batch once there is capacity, unless an
+	// earlier deploy failed.
+	dispatch := func(batch []int) {
+		sem <- struct{}{}
+		mu.Lock()
+		stop := !r.KeepGoing && s.failed()
+		if stop {
+			for _, i := range batch {
+				s.Results[i].Outcome = OutcomeSkipped
+				s.Results[i].Reason = "an earlier deploy failed"
+			}
+		}
+		mu.Unlock()
+		if stop {
+			<-sem
+			return
+		}
+
+		deploys.Add(1)
+		go func() {
+			defer func() { <-sem; deploys.Done() }()
+			batchTargets := make([]Target, len(batch))
+			for n, i := range batch {
+				batchTargets[n] = targets[i]
+			}
+			errs := deploy(ctx, batchTargets)
+
+			mu.Lock()
+			defer mu.Unlock()
+			for n, i := range batch {
+				if err := errs[n]; err != nil {
+					s.Results[i].Outcome = OutcomeFailed
+					s.Results[i].Reason = err.Error()
+					continue
+				}
+				s.Results[i].Outcome = OutcomeDeployed
+			}
+		}()
+	}
+
+	var ungated []int
+	for _, i := range ready {
+		if r.Approve == nil || r.Gated == nil || !r.Gated(targets[i]) {
+			ungated = append(ungated, i)
+			continue
+		}
+		approvals.Add(1)
+		go func() {
+			defer approvals.Done()
+			if err := r.Approve(ctx, targets[i]); err != nil {
+				mu.Lock()
+				s.Results[i].Outcome = OutcomeFailed
+				s.Results[i].Reason = err.Error()
+				mu.Unlock()
+				return
+			}
+			dispatch([]int{i})
+		}()
+	}
+	for start := 0; start < len(ungated); start += batchSize {
+		dispatch(ungated[start:min(start+batchSize, len(ungated))])
+	}
+	approvals.Wait()
+	deploys.Wait()
+}
+
+// unmetPrerequisite returns the first prerequisite of the app whose
+// deploy to the environment in the summary did not succeed, or an empty
+// string if there is none. Prerequisites which are not deployed to the
+// environment in the run are passed through to their own prerequisites,
+// the same way Waves orders the targets.
+func (s *Summary) unmetPrerequisite(deployAfter map[string][]string, app, env string) string {
+	seen := map[string]bool{}
+	var visit func(app string) string
+	visit = func(app string) string {
+		for _, dep := range deployAfter[app] {
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+
+			inRun := false
+			for _, res := range s.Results {
+				if res.App != dep || res.Environment != env {
+					continue
+				}
+				inRun = true
+				if res.Outcome != OutcomeDeployed {
+					return dep
+				}
+			}
+			if inRun {
+				continue
+			}
+			if unmet := visit(dep); unmet != "" {
+				return unmet
+			}
+		}
+		return ""
+	}
+	return visit(app)
+}
+
+// failed returns true if any deploy in the summary failed.
+func (s *Summary) failed() bool {
+	for _, res := range s.Results {
+		if res.Outcome == OutcomeFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns an error listing every deploy which failed, if any did.
+func (s *Summary) Err() error {
+	var failed []string
+	for _, res := range s.Results {
+		if res.Outcome == OutcomeFailed {
+			failed = append(failed, Target{App: res.App, Environment: res.Environment}.String())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d deploys failed: %s", len(failed), len(s.Results), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Print writes the results as a table.
+func (s *Summary) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "APP\tENVIRONMENT\tRESULT\tREASON")
+	for _, res := range s.Results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", res.App, orDefault(res.Environment), res.Outcome, res.Reason)
+	}
+	tw.Flush()
+}
+
+// WriteJSON writes the summary to path for later CI steps, creating any
+// missing parent directories.
+func (s *Summary) WriteJSON(path string) error {
+	bs, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal deploy summary: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create deploy summary directory: %v", err)
+	}
+	if err := os.WriteFile(path, bs, 0o644); err != nil {
+		return fmt.Errorf("failed to write deploy summary %s: %v", path, err)
+	}
+	return nil
+}
+
+func orDefault(env string) string {
+	if env == "" {
+		return "default"
+	}
+	return env
+}
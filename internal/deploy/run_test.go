@@ -0,0 +1,205 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunnerBoundsConcurrency(t *testing.T) {
+	targets := []Target{{App: "a"}, {App: "b"}, {App: "c"}, {App: "d"}, {App: "e"}}
+	var inFlight, peak int32
+	s, err := Runner{Concurrency: 2}.Run(context.Background(), targets, func(ctx context.Context, t Target) error {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if peak > 2 {
+		t.Errorf("expected at most 2 deploys in flight, got %d", peak)
+	}
+	if err := s.Err(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, res := range s.Results {
+		if res.Outcome != OutcomeDeployed {
+			t.Errorf("%s: expected %s, got %s", res.App, OutcomeDeployed, res.Outcome)
+		}
+	}
+}
+
+func TestRunnerStopsAfterFailure(t *testing.T) {
+	targets := []Target{{App: "a"}, {App: "b"}, {App: "c"}}
+	deploy := func(ctx context.Context, t Target) error {
+		if t.App == "a" {
+			return errors.New("boom")
+		}
+		return nil
+	}
+
+	s, _ := Runner{Concurrency: 1}.Run(context.Background(), targets, deploy)
+	want := []Outcome{OutcomeFailed, OutcomeSkipped, OutcomeSkipped}
+	for i, res := range s.Results {
+		if res.Outcome != want[i] {
+			t.Errorf("%s: expected %s, got %s", res.App, want[i], res.Outcome)
+		}
+	}
+	if s.Err() == nil {
+		t.Error("expected an error")
+	}
+
+	s, _ = Runner{Concurrency: 1, KeepGoing: true}.Run(context.Background(), targets, deploy)
+	want = []Outcome{OutcomeFailed, OutcomeDeployed, OutcomeDeployed}
+	for i, res := range s.Results {
+		if res.Outcome != want[i] {
+			t.Errorf("keep going %s: expected %s, got %s", res.App, want[i], res.Outcome)
+		}
+	}
+}
+
+func TestRunnerSkipsDependents(t *testing.T) {
+	targets := []Target{
+		{App: "api", Environment: "clever-dev"},
+		{App: "api", Environment: "production"},
+		{App: "migrations", Environment: "clever-dev"},
+		{App: "migrations", Environment: "production"},
+		{App: "other", Environment: "production"},
+	}
+	var waited []string
+	r := Runner{
+		Concurrency: 4,
+		KeepGoing:   true,
+		DeployAfter: map[string][]string{"api": {"migrations"}},
+		Wait: func(ctx context.Context, targets []Target) []error {
+			errs := make([]error, len(targets))
+			for i, t := range targets {
+				waited = append(waited, t.App)
+				if t.App == "migrations" && t.Environment == "production" {
+					errs[i] = errors.New("rollout failed")
+				}
+			}
+			return errs
+		},
+	}
+	s, err := r.Run(context.Background(), targets, func(ctx context.Context, t Target) error { return nil })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Only the deploy after the failed prerequisite in the same
+	// environment is skipped.
+	want := []Outcome{OutcomeDeployed, OutcomeSkipped, OutcomeDeployed, OutcomeFailed, OutcomeDeployed}
+	for i, res := range s.Results {
+		if res.Outcome != want[i] {
+			t.Errorf("%s to %s: expected %s, got %s", res.App, res.Environment, want[i], res.Outcome)
+		}
+	}
+	if len(waited) != 4 {
+		t.Errorf("expected to wait on every deploy but api to production, waited on %v", waited)
+	}
+}
+
+func TestRunnerSkipsDependentsThroughAppsNotInRun(t *testing.T) {
+	// worker is deployed after migrations through api, which has no
+	// changes.
+	targets := []Target{{App: "migrations"}, {App: "worker"}}
+	r := Runner{
+		KeepGoing:   true,
+		DeployAfter: map[string][]string{"worker": {"api"}, "api": {"migrations"}},
+	}
+	s, err := r.Run(context.Background(), targets, func(ctx context.Context, t Target) error {
+		if t.App == "migrations" {
+			return errors.New("deploy failed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if res := s.Results[1]; res.Outcome != OutcomeSkipped || res.Reason != "prerequisite migrations was not deployed" {
+		t.Errorf("expected worker to be skipped after migrations, got %s: %s", res.Outcome, res.Reason)
+	}
+}
+
+func TestRunnerBatches(t *testing.T) {
+	targets := []Target{{App: "a"}, {App: "b"}, {App: "c"}, {App: "d", Environment: "production"}, {App: "e"}}
+	var batches [][]string
+	s, err := Runner{Concurrency: 1, KeepGoing: true}.RunBatches(context.Background(), targets, 2, func(ctx context.Context, batch []Target) []error {
+		var apps []string
+		errs := make([]error, len(batch))
+		for i, t := range batch {
+			apps = append(apps, t.App)
+			if t.App == "d" {
+				errs[i] = errors.New("throttled")
+			}
+		}
+		batches = append(batches, apps)
+		return errs
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(batches) != 3 || len(batches[0]) != 2 || len(batches[2]) != 1 {
+		t.Errorf("expected batches of 2, 2 and 1, got %v", batches)
+	}
+	if err := s.Err(); err == nil || err.Error() != "1 of 5 deploys failed: d to production" {
+		t.Errorf("expected d to fail, got %v", err)
+	}
+}
+
+func TestRunnerApprovesBeforeBatching(t *testing.T) {
+	targets := []Target{{App: "a", Environment: "production"}, {App: "b"}, {App: "c", Environment: "production"}, {App: "d"}}
+	ungatedDeployed := make(chan struct{})
+	var (
+		mu      sync.Mutex
+		batches [][]string
+	)
+	r := Runner{
+		Concurrency: 2,
+		KeepGoing:   true,
+		Gated:       func(t Target) bool { return t.Environment == "production" },
+		Approve: func(ctx context.Context, t Target) error {
+			// Approvals are only decided once the ungated deploys are
+			// done, so they must not be held up waiting on them.
+			<-ungatedDeployed
+			if t.App == "c" {
+				return errors.New("rejected")
+			}
+			return nil
+		},
+	}
+	s, err := r.RunBatches(context.Background(), targets, 10, func(ctx context.Context, batch []Target) []error {
+		var apps []string
+		for _, t := range batch {
+			apps = append(apps, t.App)
+		}
+		mu.Lock()
+		batches = append(batches, apps)
+		mu.Unlock()
+		if apps[0] == "b" {
+			close(ungatedDeployed)
+		}
+		return make([]error, len(batch))
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(batches) != 2 || strings.Join(batches[0], ",") != "b,d" || strings.Join(batches[1], ",") != "a" {
+		t.Errorf("expected batches [b d] and [a], got %v", batches)
+	}
+	if err := s.Err(); err == nil || err.Error() != "1 of 4 deploys failed: c to production" {
+		t.Errorf("expected c to fail, got %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Status is the rollout status of a deploy.
+type Status string
+
+const (
+	StatusPending    Status = "pending"
+	StatusInProgress Status = "in_progress"
+	StatusSucceeded  Status = "succeeded"
+	StatusFailed     Status = "failed"
+)
+
+// Done returns true once the deploy has finished, successfully or not.
+func (s Status) Done() bool {
+	return s == StatusSucceeded || s == StatusFailed
+}
+
+// Target identifies a single app deploy to an environment. An empty
+// Environment or Strategy leaves the choice to the deploy system.
+type Target struct {
+	App         string
+	Environment string
+	// Strategy is the deployment strategy, if the deploy system
+	// supports one.
+	Strategy string
+	// Revision is the build being deployed.
+	Revision string
+}
+
+func (t Target) String() string {
+	if t.Environment == "" {
+		return t.App
+	}
+	return fmt.Sprintf("%s to %s", t.App, t.Environment)
+}
+
+// Report is the status of a deploy at a point in time, with an optional
+// human readable explanation.
+type Report struct {
+	Status  Status `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// StatusSource reports the current status of a deploy. Sources may poll
+// an API or consume deploy status events.
+type StatusSource interface {
+	Status(ctx context.Context, t Target) (Report, error)
+}
+
+// HTTPStatusSource polls a deploy status endpoint. Each request is a GET
+// to URL with app, environment and revision query parameters, which
+// responds with a JSON Report.
+type HTTPStatusSource struct {
+	URL string
+	// Username and Password are sent with basic auth if set.
+	Username string
+	Password string
+	Client   *http.Client
+}
+
+func (h *HTTPStatusSource) Status(ctx context.Context, t Target) (Report, error) {
+	u, err := url.Parse(h.URL)
+	if err != nil {
+		return Report{}, fmt.Errorf("invalid deploy status url: %v", err)
+	}
+	q := u.Query()
+	q.Set("app", t.App)
+	q.Set("environment", t.Environment)
+	q.Set("revision", t.Revision)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Report{}, err
+	}
+	if h.Username != "" {
+		req.SetBasicAuth(h.Username, h.Password)
+	}
+
+	cli := h.Client
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return Report{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Report{}, fmt.Errorf("deploy status endpoint responded %s", resp.Status)
+	}
+
+	var r Report
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return Report{}, fmt.Errorf("failed to decode deploy status: %v", err)
+	}
+	return r, nil
+}
+
+// Waiter waits for deploys to finish by polling a StatusSource.
+type Waiter struct {
+	Source   StatusSource
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// Wait polls the status of every target until all of them finish or
+// the timeout passes, logging each status change. An error listing
+// every failed or unfinished deploy is returned if any did not succeed.
+func (w *Waiter) Wait(ctx context.Context, targets []Target) error {
+	return errors.Join(w.WaitEach(ctx, targets)...)
+}
+
+// WaitEach is like Wait, but returns the error of each target at the
+// same index as the target. Targets which succeeded have a nil error.
+func (w *Waiter) WaitEach(ctx context.Context, targets []Target) []error {
+	ctx, cancel := context.WithTimeout(ctx, w.Timeout)
+	defer cancel()
+
+	fmt.Println("Waiting up to", w.Timeout, "for", len(targets), "deploys to finish")
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(targets))
+	)
+	for i, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = w.waitOne(ctx, t)
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+func (w *Waiter) waitOne(ctx context.Context, t Target) error {
+	var last Report
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		r, err := w.Source.Status(ctx, t)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			// The status source may be temporarily unavailable, so
+			// keep polling until the timeout.
+			fmt.Printf("failed to get deploy status of %s: %v\n", t, err)
+		case err == nil && r != last:
+			fmt.Printf("deploy of %s: %s\n", t, describe(last, r))
+			last = r
+		}
+
+		switch last.Status {
+		case StatusSucceeded:
+			return nil
+		case StatusFailed:
+			return fmt.Errorf("deploy of %s failed: %s", t, last.Message)
+		}
+
+		select {
+		case <-ctx.Done():
+			status := last.Status
+			if status == "" {
+				status = "unknown"
+			}
+			return fmt.Errorf("timed out waiting for deploy of %s, last status %s", t, status)
+		case <-ticker.C:
+		}
+	}
+}
+
+func describe(prev, cur Report) string {
+	out := string(cur.Status)
+	if prev.Status != "" && prev.Status != cur.Status {
+		out = fmt.Sprintf("%s -> %s", prev.Status, cur.Status)
+	}
+	if cur.Message != "" {
+		out += " (" + cur.Message + ")"
+	}
+	return out
+}
@@ -0,0 +1,85 @@
+package deploy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStatusServer serves a scripted sequence of reports per app. Once
+// an app's script is exhausted its last report is repeated.
+func fakeStatusServer(t *testing.T, scripts map[string][]Report) *httptest.Server {
+	var (
+		mu    sync.Mutex
+		polls = map[string]int{}
+	)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app := r.URL.Query().Get("app")
+		if r.URL.Query().Get("revision") != "abc1234" {
+			t.Errorf("expected revision abc1234, got %q", r.URL.Query().Get("revision"))
+		}
+		mu.Lock()
+		script, ok := scripts[app]
+		n := polls[app]
+		polls[app]++
+		mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(script[min(n, len(script)-1)])
+	}))
+}
+
+func TestWaiterWait(t *testing.T) {
+	srv := fakeStatusServer(t, map[string][]Report{
+		"ok-app":      {{Status: StatusPending}, {Status: StatusInProgress}, {Status: StatusSucceeded}},
+		"broken-app":  {{Status: StatusInProgress}, {Status: StatusFailed, Message: "health checks failing"}},
+		"stalled-app": {{Status: StatusInProgress}},
+	})
+	defer srv.Close()
+
+	w := &Waiter{
+		Source:   &HTTPStatusSource{URL: srv.URL},
+		Interval: time.Millisecond,
+		Timeout:  200 * time.Millisecond,
+	}
+
+	tests := []struct {
+		name    string
+		apps    []string
+		wantErr []string
+	}{
+		{name: "success", apps: []string{"ok-app"}},
+		{name: "failure", apps: []string{"ok-app", "broken-app"}, wantErr: []string{"broken-app to production failed: health checks failing"}},
+		{name: "timeout", apps: []string{"stalled-app"}, wantErr: []string{"timed out waiting for deploy of stalled-app to production, last status in_progress"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets := []Target{}
+			for _, app := range tt.apps {
+				targets = append(targets, Target{App: app, Environment: "production", Revision: "abc1234"})
+			}
+
+			err := w.Wait(t.Context(), targets)
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error to contain %q, got %q", want, err)
+				}
+			}
+		})
+	}
+}
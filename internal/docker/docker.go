@@ -15,6 +15,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	ecrtypes "github.com/aws/aws-sdk-go-v2/service/ecr/types"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/archive"
@@ -93,11 +94,12 @@ func (d *Docker) Build(ctx context.Context, contextDir, dockerfile string, tags
 
 // Push the tags to their private ecr repository. If a tag is not for a
 // private ecr repository, Push will panic. Each tag is pushed in a
-// separate goroutine.
-func (d *Docker) Push(ctx context.Context, tags []string) error {
+// separate goroutine. The digest of the pushed image is returned.
+func (d *Docker) Push(ctx context.Context, tags []string) (string, error) {
 	grp, grpCtx := errgroup.WithContext(ctx)
+	digests := make([]string, len(tags))
 
-	for _, tag := range tags {
+	for i, tag := range tags {
 		tag := tag
 		fmt.Println("pushing", tag)
 
@@ -112,11 +114,21 @@ func (d *Docker) Push(ctx context.Context, tags []string) error {
 			}
 
 			defer res.Close()
-			return print(res)
+			digests[i], err = printDigest(res)
+			return err
 		})
 	}
 
-	return grp.Wait()
+	if err := grp.Wait(); err != nil {
+		return "", err
+	}
+	// Every tag is the same image, so any reported digest will do.
+	for _, digest := range digests {
+		if digest != "" {
+			return digest, nil
+		}
+	}
+	return "", nil
 }
 
 // fetch and cache docker client ecr credentials for the specified region.
@@ -157,6 +169,26 @@ func (d *Docker) ecrCredentials(ctx context.Context, region string) error {
 	return nil
 }
 
+// ImageExists returns an error unless the image of the artifact tagged
+// with the revision is still in ECR.
+func ImageExists(ctx context.Context, ecrRole, artifact, revision string) error {
+	cfg := environment.AWSCfg(ctx, ecrRole)
+	cfg.Region = ecrRootRegion
+	_, err := ecr.NewFromConfig(cfg).DescribeImages(ctx, &ecr.DescribeImagesInput{
+		RegistryId:     aws.String(environment.ECRAccountID()),
+		RepositoryName: aws.String(artifact),
+		ImageIds:       []ecrtypes.ImageIdentifier{{ImageTag: aws.String(revision)}},
+	})
+	var nf *ecrtypes.ImageNotFoundException
+	if errors.As(err, &nf) {
+		return fmt.Errorf("image %s:%s no longer exists in ECR", artifact, revision)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check for image %s:%s in ECR: %v", artifact, revision, err)
+	}
+	return nil
+}
+
 func encodeCreds(cfg types.AuthConfig) string {
 	bs, _ := json.Marshal(cfg)
 	return base64.URLEncoding.EncodeToString(bs)
@@ -182,25 +214,41 @@ func readDockerignore(contextDir string) ([]string, error) {
 // build errors, an error is returned by print. If there were no build
 // errors then print returns nil.
 func print(r io.Reader) error {
-	var line string
+	_, err := printDigest(r)
+	return err
+}
+
+// printDigest is print for push output, which also returns the image
+// digest reported by the daemon once the push finishes.
+func printDigest(r io.Reader) (string, error) {
+	var line, digest string
 	scanner := bufio.NewScanner(io.TeeReader(r, os.Stdout))
 	for scanner.Scan() {
 		line = scanner.Text()
+
+		aux := struct {
+			Aux struct {
+				Digest string `json:"Digest"`
+			} `json:"aux"`
+		}{}
+		if json.Unmarshal([]byte(line), &aux) == nil && aux.Aux.Digest != "" {
+			digest = aux.Aux.Digest
+		}
 	}
 
 	e := struct {
 		Error string `json:"error"`
 	}{}
 	if err := json.Unmarshal([]byte(line), &e); err != nil {
-		return fmt.Errorf("failed to unmarhsal docker daemon response: %v", err)
+		return "", fmt.Errorf("failed to unmarhsal docker daemon response: %v", err)
 	}
 	if e.Error != "" {
-		return fmt.Errorf("error from docker daemon: %s", e.Error)
+		return "", fmt.Errorf("error from docker daemon: %s", e.Error)
 	}
 
 	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("failed to read docker daemon response: %v", err)
+		return "", fmt.Errorf("failed to read docker daemon response: %v", err)
 	}
 
-	return nil
+	return digest, nil
 }
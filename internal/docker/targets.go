@@ -12,6 +12,8 @@ import (
 // DockerTarget contains information about how to build and push a
 // docker build target.
 type DockerTarget struct {
+	// Artifact is the name of the image repository.
+	Artifact string
 	// Tags are the list of tags to push for the built docker image.
 	Tags []string
 	// Command is the command to run to build the lambda artifact.
@@ -64,8 +66,9 @@ func BuildTargets(apps map[string]*models.LaunchConfig) (map[string]DockerTarget
 		tags = append(tags, tag)
 
 		targets[repo.Dockerfile(launch)] = DockerTarget{
-			Tags:    tags,
-			Command: repo.BuildCommand(launch),
+			Artifact: artifact,
+			Tags:     tags,
+			Command:  repo.BuildCommand(launch),
 		}
 	}
 	return targets, artifacts
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -12,6 +14,30 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
+const (
+	defaultLambdaBucketTemplate = "{prefix}-{region}"
+	defaultManifestPath         = "./bin/goci-manifest.json"
+	defaultDeploySummaryPath    = "./bin/goci-deploy-summary.json"
+	defaultRetryMaxElapsedTime  = 2 * time.Minute
+	defaultCIIntegrationsAuth   = "basic"
+	defaultCatalogSyncPolicy    = "warn"
+	defaultPlatformEventsSink   = "eventbridge"
+	defaultPlatformEventsBus    = "production--platform-events"
+	defaultPlatformEventsSource = "circle-ci"
+	defaultPlatformEventsFile   = "./bin/goci-events.jsonl"
+	defaultApprover             = "circleci"
+	defaultApprovalDir          = "./bin/goci-approvals"
+	defaultApprovalJob          = "approve-{environment}"
+	defaultCircleAPIURL         = "https://circleci.com/api/v2"
+)
+
+var (
+	defaultLambdaRegions  = []string{"us-west-1", "us-west-2", "us-east-1"}
+	defaultDeployBranches = []string{"master"}
+	// defaultKnownEnvironments are the environments apps are deployed to.
+	defaultKnownEnvironments = []string{"clever-dev", "production"}
+)
+
 var (
 	// ECRAccountID is the account ID for clever's ECR repositories.
 	ecrAccountID = ""
@@ -21,24 +47,23 @@ var (
 	// built in CI.
 	shortSHA1 = ""
 	// LambdaArtifactBucketPrefix is the prefix of the S3 buckets which
-	// hold Clever's lambda artifacts. There are 4 total – one for each
-	// region. The naming scheme is '<prefix>-<region>'
+	// hold Clever's lambda artifacts. There is one bucket for each
+	// region, named according to LambdaBucketTemplate.
 	lambdaArtifactBucketPrefix = ""
+	// LambdaBucketTemplate is the naming template of the regional lambda
+	// artifact buckets. The placeholders {prefix} and {region} are
+	// replaced with LambdaArtifactBucketPrefix and the region.
+	lambdaBucketTemplate = ""
+	// GlueArtifactBucketPrefix is the prefix of the S3 bucket which holds
+	// Clever's spark job artifacts. Glue only runs in us-west-2 so there
+	// is a single bucket named '<prefix>-us-west-2'.
+	glueArtifactBucketPrefix = ""
 	// PreviousPipelineCompare is the git commit range to run change
 	// detection commands against when running for the primary branch.
 	previousPipelineCompare = ""
 	// PrimaryCompare is the git commit range to run change detection
 	// commands against when running for a non-primary branch.
 	primaryCompare = ""
-	// CatapultURL is the dns of the circle-ci-integrations ALB
-	// including the protocol.
-	catapultURL = ""
-	// CatapultUser is the username to access circle-ci-integrations via
-	// basic auth.
-	catapultUser = ""
-	// CatapultPassword is the password to access circle-ci-integrations
-	// via basic auth.
-	catapultPassword = ""
 	// CircleUser is the name of the ci user assigned by our ci
 	// environment.
 	circleUser = ""
@@ -55,13 +80,37 @@ var (
 	// OidcEcrUploadRole is the ARN of the role used to assume the ecr
 	// upload role.
 	oidcEcrUploadRole = ""
+	// OidcGlueUploadRole is the ARN of the role used to upload spark job
+	// artifacts.
+	oidcGlueUploadRole = ""
+	// OidcS3UploadRole is the ARN of the role used to upload static
+	// files.
+	oidcS3UploadRole = ""
 	// OidcEventBridgeRole is the ARN of the role used to publish platform
 	// events to EventBridge.
 	oidcEventBridgeRole = ""
 
 	// LambdaRegions is the set of regions to upload Lambda artifacts to.
-	// Lambda artifacts are not replicated and must be uploaded to each region.
-	LambdaRegions = []string{"us-west-1", "us-west-2", "us-east-1"}
+	// Lambda artifacts are not replicated and must be uploaded to each
+	// region. It is a comma separated list which defaults to
+	// defaultLambdaRegions.
+	lambdaRegions []string
+
+	// DeployBranches are the branches which deploy to an app's
+	// autoDeployEnvs. It is a comma separated list which defaults to
+	// defaultDeployBranches.
+	deployBranches []string
+
+	// KnownEnvironments are the environments stack configs may deploy
+	// to. It is a comma separated list which defaults to
+	// defaultKnownEnvironments.
+	knownEnvironments []string
+
+	// ManifestPath is the path the build manifest is written to.
+	manifestPath = ""
+	// DeploySummaryPath is the path the JSON summary of deploy results
+	// is written to.
+	deploySummaryPath = ""
 
 	// Local is a boolean which should be set to true when running
 	// locally on a developers machine.
@@ -69,14 +118,81 @@ var (
 	// SlingshotURL is the DNS of the slingshot service.
 	slingshotURL = ""
 
-	// CircleTriggeredBy is the username of the user who triggered the CI run.
+	// DeployStatusURL is the endpoint polled for the rollout status of
+	// deploys when waiting for them to finish.
+	deployStatusURL = ""
+	// DeployStatusUser and DeployStatusPassword are the optional basic
+	// auth credentials of the deploy status endpoint.
+	deployStatusUser     = ""
+	deployStatusPassword = ""
+
+	// RetryMaxElapsedTime is the total time calls to
+	// circle-ci-integrations are retried for. It is a go duration string.
+	retryMaxElapsedTime = time.Duration(0)
+
+	// CircleTriggeredBy is the username of the user who triggered the CI
+	// run. Scheduled pipelines have none.
 	circleTriggeredBy = ""
-	// URL for circle-ci-integrations
+	// CIIntegrationsURL is the dns of the circle-ci-integrations ALB
+	// including the protocol.
 	ciIntegrationsURL = ""
-	// username for basic authentication to circle-ci-integrations
-	ciIntegrationsUser = ""
-	// password for basic authentication to circle-ci-integrations
+	// CIIntegrationsAuth is how requests to circle-ci-integrations are
+	// authenticated, one of basic, bearer or oidc.
+	ciIntegrationsAuth = ""
+	// CIIntegrationsUser and CIIntegrationsPassword are the basic auth
+	// credentials of circle-ci-integrations.
+	ciIntegrationsUser     = ""
 	ciIntegrationsPassword = ""
+	// CIIntegrationsToken is the bearer token of circle-ci-integrations.
+	ciIntegrationsToken = ""
+	// CatalogSyncPolicy decides how catalog sync failures affect the
+	// build, one of ignore, warn or fail.
+	catalogSyncPolicy = ""
+
+	// PlatformEventsSink is where platform events are delivered, one of
+	// eventbridge, file or webhook.
+	platformEventsSink = ""
+	// PlatformEventsBus is the EventBridge bus platform events are put
+	// on, and PlatformEventsSource their source.
+	platformEventsBus    = ""
+	platformEventsSource = ""
+	// PlatformEventsFile is the JSONL file platform events are appended
+	// to by the file sink.
+	platformEventsFile = ""
+	// PlatformEventsWebhookURL is the endpoint the webhook sink posts
+	// platform events to, signed with PlatformEventsWebhookSecret.
+	platformEventsWebhookURL    = ""
+	platformEventsWebhookSecret = ""
+
+	// Approver is what approves deploys to gated environments, one of
+	// circleci, http or file.
+	approver = ""
+	// ApprovalURL is the endpoint of the http approver, authenticated
+	// with the optional ApprovalToken.
+	approvalURL   = ""
+	approvalToken = ""
+	// ApprovalDir is the directory the file approver keeps approvals in.
+	approvalDir = ""
+	// ApprovalJob is the name of the CircleCI approval job gating each
+	// deploy, in which {app} and {environment} are replaced.
+	approvalJob = ""
+	// CircleAPIURL is the CircleCI v2 API, called with CircleToken.
+	circleAPIURL = ""
+	circleToken  = ""
+	// CircleWorkflowID is the ID of the CircleCI workflow running goci.
+	circleWorkflowID = ""
+
+	// DeployHistory is where past deploys are read from when rolling
+	// back, one of file or http. It has no default, since a file in the
+	// build's working directory would not outlive the build.
+	deployHistory = ""
+	// DeployHistoryPath is the JSONL file deploys are recorded in by the
+	// file history.
+	deployHistoryPath = ""
+	// DeployHistoryURL is the endpoint of the http history, authenticated
+	// with the optional DeployHistoryToken.
+	deployHistoryURL   = ""
+	deployHistoryToken = ""
 )
 
 func ECRAccountID() string {
@@ -107,39 +223,76 @@ func LambdaArtifactBucketPrefix() string {
 	return lambdaArtifactBucketPrefix
 }
 
-func PreviousPipelineCompare() string {
-	if previousPipelineCompare == "" {
-		previousPipelineCompare = envMustString("PREVIOUS_PIPELINE_COMPARE", false)
+func LambdaBucketTemplate() string {
+	if lambdaBucketTemplate == "" {
+		lambdaBucketTemplate = envDefaultString("LAMBDA_AWS_BUCKET_TEMPLATE", defaultLambdaBucketTemplate)
 	}
-	return previousPipelineCompare
+	return lambdaBucketTemplate
 }
 
-func PrimaryCompare() string {
-	if primaryCompare == "" {
-		primaryCompare = envMustString("MASTER_COMPARE", true)
+func LambdaRegions() []string {
+	if lambdaRegions == nil {
+		lambdaRegions = envList("LAMBDA_AWS_REGIONS")
+		if len(lambdaRegions) == 0 {
+			lambdaRegions = defaultLambdaRegions
+		}
 	}
-	return primaryCompare
+	return lambdaRegions
 }
 
-func CatapultURL() string {
-	if catapultURL == "" {
-		catapultURL = envMustString("CATAPULT_URL", true)
+func DeployBranches() []string {
+	if deployBranches == nil {
+		deployBranches = envList("DEPLOY_BRANCHES")
+		if len(deployBranches) == 0 {
+			deployBranches = defaultDeployBranches
+		}
+	}
+	return deployBranches
+}
+
+func KnownEnvironments() []string {
+	if knownEnvironments == nil {
+		knownEnvironments = envList("GOCI_KNOWN_ENVIRONMENTS")
+		if len(knownEnvironments) == 0 {
+			knownEnvironments = defaultKnownEnvironments
+		}
+	}
+	return knownEnvironments
+}
+
+func ManifestPath() string {
+	if manifestPath == "" {
+		manifestPath = envDefaultString("GOCI_MANIFEST_PATH", defaultManifestPath)
+	}
+	return manifestPath
+}
+
+func GlueArtifactBucketPrefix() string {
+	if glueArtifactBucketPrefix == "" {
+		glueArtifactBucketPrefix = envMustString("GLUE_AWS_BUCKET", true)
 	}
-	return catapultURL
+	return glueArtifactBucketPrefix
 }
 
-func CatapultUser() string {
-	if catapultUser == "" {
-		catapultUser = envMustString("CATAPULT_USER", true)
+func DeploySummaryPath() string {
+	if deploySummaryPath == "" {
+		deploySummaryPath = envDefaultString("GOCI_DEPLOY_SUMMARY_PATH", defaultDeploySummaryPath)
 	}
-	return catapultUser
+	return deploySummaryPath
 }
 
-func CatapultPassword() string {
-	if catapultPassword == "" {
-		catapultPassword = envMustString("CATAPULT_PASS", true)
+func PreviousPipelineCompare() string {
+	if previousPipelineCompare == "" {
+		previousPipelineCompare = envMustString("PREVIOUS_PIPELINE_COMPARE", false)
 	}
-	return catapultPassword
+	return previousPipelineCompare
+}
+
+func PrimaryCompare() string {
+	if primaryCompare == "" {
+		primaryCompare = envMustString("MASTER_COMPARE", true)
+	}
+	return primaryCompare
 }
 
 func CircleUser() string {
@@ -151,7 +304,7 @@ func CircleUser() string {
 
 func CircleTriggeredBy() string {
 	if circleTriggeredBy == "" {
-		circleTriggeredBy = envMustString("CIRCLE_USERNAME", true)
+		circleTriggeredBy = envMustString("CIRCLE_USERNAME", false)
 	}
 	return circleTriggeredBy
 }
@@ -191,6 +344,20 @@ func OidcEcrUploadRole() string {
 	return oidcEcrUploadRole
 }
 
+func OidcGlueUploadRole() string {
+	if oidcGlueUploadRole == "" {
+		oidcGlueUploadRole = envMustString("OIDC_GLUE_UPLOAD_ROLE", false)
+	}
+	return oidcGlueUploadRole
+}
+
+func OidcS3UploadRole() string {
+	if oidcS3UploadRole == "" {
+		oidcS3UploadRole = envMustString("OIDC_S3_UPLOAD_ROLE", false)
+	}
+	return oidcS3UploadRole
+}
+
 func OidcEventBridgeRole() string {
 	if oidcEventBridgeRole == "" {
 		oidcEventBridgeRole = envMustString("OIDC_EVENTBRIDGE_ROLE", false)
@@ -205,27 +372,213 @@ func SlingshotURL() string {
 	return slingshotURL
 }
 
-func CIIntegrationsUrl() string {
+// CIIntegrationsURL falls back to the legacy CATAPULT_URL, which held
+// the full url of the catapult endpoint when circle-ci-integrations was
+// requested via curl. The path is trimmed so only the protocol and
+// hostname remain.
+func CIIntegrationsURL() string {
 	if ciIntegrationsURL == "" {
-		ciIntegrationsURL = envMustString("CIRCLE_CI_INTEGRATIONS_URL", true)
+		ciIntegrationsURL = envFallbackString("CIRCLE_CI_INTEGRATIONS_URL", "CATAPULT_URL")
+		ciIntegrationsURL = strings.TrimSuffix(ciIntegrationsURL, "/v2/catapult")
+		ciIntegrationsURL = strings.TrimSuffix(ciIntegrationsURL, "/catapult")
 	}
 	return ciIntegrationsURL
 }
 
+func CIIntegrationsAuth() string {
+	if ciIntegrationsAuth == "" {
+		ciIntegrationsAuth = envDefaultString("CIRCLE_CI_INTEGRATIONS_AUTH", defaultCIIntegrationsAuth)
+	}
+	return ciIntegrationsAuth
+}
+
 func CIIntegrationsUser() string {
 	if ciIntegrationsUser == "" {
-		ciIntegrationsUser = envMustString("CIRCLE_CI_INTEGRATIONS_USER", true)
+		ciIntegrationsUser = envFallbackString("CIRCLE_CI_INTEGRATIONS_USER", "CATAPULT_USER")
 	}
 	return ciIntegrationsUser
 }
 
 func CIIntegrationsPassword() string {
 	if ciIntegrationsPassword == "" {
-		ciIntegrationsPassword = envMustString("CIRCLE_CI_INTEGRATIONS_PASS", true)
+		ciIntegrationsPassword = envFallbackString("CIRCLE_CI_INTEGRATIONS_PASS", "CATAPULT_PASS")
 	}
 	return ciIntegrationsPassword
 }
 
+func CIIntegrationsToken() string {
+	if ciIntegrationsToken == "" {
+		ciIntegrationsToken = envMustString("CIRCLE_CI_INTEGRATIONS_TOKEN", true)
+	}
+	return ciIntegrationsToken
+}
+
+func CatalogSyncPolicy() string {
+	if catalogSyncPolicy == "" {
+		catalogSyncPolicy = envDefaultString("CATALOG_SYNC_POLICY", defaultCatalogSyncPolicy)
+	}
+	return catalogSyncPolicy
+}
+
+func PlatformEventsSink() string {
+	if platformEventsSink == "" {
+		platformEventsSink = envDefaultString("PLATFORM_EVENTS_SINK", defaultPlatformEventsSink)
+	}
+	return platformEventsSink
+}
+
+func PlatformEventsBus() string {
+	if platformEventsBus == "" {
+		platformEventsBus = envDefaultString("PLATFORM_EVENTS_BUS", defaultPlatformEventsBus)
+	}
+	return platformEventsBus
+}
+
+func PlatformEventsSource() string {
+	if platformEventsSource == "" {
+		platformEventsSource = envDefaultString("PLATFORM_EVENTS_SOURCE", defaultPlatformEventsSource)
+	}
+	return platformEventsSource
+}
+
+func PlatformEventsFile() string {
+	if platformEventsFile == "" {
+		platformEventsFile = envDefaultString("PLATFORM_EVENTS_FILE", defaultPlatformEventsFile)
+	}
+	return platformEventsFile
+}
+
+func PlatformEventsWebhookURL() string {
+	if platformEventsWebhookURL == "" {
+		platformEventsWebhookURL = envMustString("PLATFORM_EVENTS_WEBHOOK_URL", true)
+	}
+	return platformEventsWebhookURL
+}
+
+func PlatformEventsWebhookSecret() string {
+	if platformEventsWebhookSecret == "" {
+		platformEventsWebhookSecret = envMustString("PLATFORM_EVENTS_WEBHOOK_SECRET", true)
+	}
+	return platformEventsWebhookSecret
+}
+
+func Approver() string {
+	if approver == "" {
+		approver = envDefaultString("GOCI_APPROVER", defaultApprover)
+	}
+	return approver
+}
+
+func ApprovalURL() string {
+	if approvalURL == "" {
+		approvalURL = envMustString("GOCI_APPROVAL_URL", true)
+	}
+	return approvalURL
+}
+
+func ApprovalToken() string {
+	if approvalToken == "" {
+		approvalToken = envMustString("GOCI_APPROVAL_TOKEN", false)
+	}
+	return approvalToken
+}
+
+func ApprovalDir() string {
+	if approvalDir == "" {
+		approvalDir = envDefaultString("GOCI_APPROVAL_DIR", defaultApprovalDir)
+	}
+	return approvalDir
+}
+
+func ApprovalJob() string {
+	if approvalJob == "" {
+		approvalJob = envDefaultString("GOCI_APPROVAL_JOB", defaultApprovalJob)
+	}
+	return approvalJob
+}
+
+func CircleAPIURL() string {
+	if circleAPIURL == "" {
+		circleAPIURL = envDefaultString("CIRCLE_API_URL", defaultCircleAPIURL)
+	}
+	return circleAPIURL
+}
+
+func CircleToken() string {
+	if circleToken == "" {
+		circleToken = envMustString("CIRCLE_TOKEN", true)
+	}
+	return circleToken
+}
+
+func CircleWorkflowID() string {
+	if circleWorkflowID == "" {
+		circleWorkflowID = envMustString("CIRCLE_WORKFLOW_ID", true)
+	}
+	return circleWorkflowID
+}
+
+func DeployHistory() string {
+	if deployHistory == "" {
+		deployHistory = envMustString("GOCI_DEPLOY_HISTORY", false)
+	}
+	return deployHistory
+}
+
+func DeployHistoryPath() string {
+	if deployHistoryPath == "" {
+		deployHistoryPath = envMustString("GOCI_DEPLOY_HISTORY_PATH", true)
+	}
+	return deployHistoryPath
+}
+
+func DeployHistoryURL() string {
+	if deployHistoryURL == "" {
+		deployHistoryURL = envMustString("GOCI_DEPLOY_HISTORY_URL", true)
+	}
+	return deployHistoryURL
+}
+
+func DeployHistoryToken() string {
+	if deployHistoryToken == "" {
+		deployHistoryToken = envMustString("GOCI_DEPLOY_HISTORY_TOKEN", false)
+	}
+	return deployHistoryToken
+}
+
+// CircleOIDCToken is the OIDC token issued to the CI job.
+func CircleOIDCToken() string {
+	return envMustString("CIRCLE_OIDC_TOKEN_V2", true)
+}
+
+func DeployStatusURL() string {
+	if deployStatusURL == "" {
+		deployStatusURL = envMustString("DEPLOY_STATUS_URL", true)
+	}
+	return deployStatusURL
+}
+
+func DeployStatusUser() string {
+	if deployStatusUser == "" {
+		deployStatusUser = envMustString("DEPLOY_STATUS_USER", false)
+	}
+	return deployStatusUser
+}
+
+func DeployStatusPassword() string {
+	if deployStatusPassword == "" {
+		deployStatusPassword = envMustString("DEPLOY_STATUS_PASS", false)
+	}
+	return deployStatusPassword
+}
+
+func RetryMaxElapsedTime() time.Duration {
+	if retryMaxElapsedTime == 0 {
+		retryMaxElapsedTime = envDuration("GOCI_RETRY_MAX_ELAPSED", defaultRetryMaxElapsedTime)
+	}
+	return retryMaxElapsedTime
+}
+
 // AWS doesn't provide a way to get the token from a string so we will
 // use this to satisfy the interface.
 type tokenRetriever struct{}
@@ -274,6 +627,28 @@ func AWSCfg(ctx context.Context, oidcRole string) aws.Config {
 	return cfg
 }
 
+// envFallbackString reads key, falling back to the legacy fallback key.
+// One of them must be set.
+func envFallbackString(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	if v := os.Getenv(fallback); v != "" {
+		return v
+	}
+	fmt.Println("env variable missing:", key)
+	os.Exit(1)
+	return ""
+}
+
+// envDefaultString reads key, returning def if it is unset.
+func envDefaultString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
 func envMustString(key string, localRequired bool) string {
 	v := os.Getenv(key)
 	if v == "" && localRequired {
@@ -284,6 +659,34 @@ func envMustString(key string, localRequired bool) string {
 	return v
 }
 
+// envList splits a comma separated environment variable into a list,
+// dropping any empty entries.
+func envList(key string) []string {
+	out := []string{}
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// envDuration parses a go duration from the environment variable,
+// returning def if it is unset.
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		fmt.Println(fmt.Errorf("invalid value %s for %s cannot be converted to a duration: %v", v, key, err))
+		os.Exit(1)
+	}
+	return d
+}
+
 func envMustInt64(key string, localRequired bool) int64 {
 	v := os.Getenv(key)
 	if v == "" && localRequired {
@@ -0,0 +1,92 @@
+package integrations
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Catalog sync policies decide how failures to sync catalog entities
+// affect the build.
+const (
+	// SyncPolicyIgnore does not report failures.
+	SyncPolicyIgnore = "ignore"
+	// SyncPolicyWarn reports failures without failing the build.
+	SyncPolicyWarn = "warn"
+	// SyncPolicyFail reports failures and fails the build.
+	SyncPolicyFail = "fail"
+)
+
+// ValidateSyncPolicy returns an error if the policy is not a known
+// catalog sync policy.
+func ValidateSyncPolicy(policy string) error {
+	switch policy {
+	case SyncPolicyIgnore, SyncPolicyWarn, SyncPolicyFail:
+		return nil
+	default:
+		return fmt.Errorf("unknown catalog sync policy %q, expected %s, %s or %s", policy, SyncPolicyIgnore, SyncPolicyWarn, SyncPolicyFail)
+	}
+}
+
+// SyncFailure is a catalog entity which failed to sync.
+type SyncFailure struct {
+	Entity string
+	Err    error
+}
+
+// SyncReport collects catalog sync failures over a run so they can be
+// reported together according to the policy. It is safe for concurrent
+// use.
+type SyncReport struct {
+	Policy string
+
+	mu       sync.Mutex
+	failures []SyncFailure
+}
+
+// NewSyncReport returns an empty report with the policy.
+func NewSyncReport(policy string) (*SyncReport, error) {
+	if err := ValidateSyncPolicy(policy); err != nil {
+		return nil, err
+	}
+	return &SyncReport{Policy: policy}, nil
+}
+
+// Record records the result of syncing the entity. A nil error is
+// ignored.
+func (r *SyncReport) Record(entity string, err error) {
+	if err == nil {
+		return
+	}
+	if r.Policy != SyncPolicyIgnore {
+		fmt.Println("failed to sync catalog entity", entity, "with catalog-config:", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures = append(r.failures, SyncFailure{Entity: entity, Err: err})
+}
+
+// Failures returns every recorded failure in the order they occurred.
+func (r *SyncReport) Failures() []SyncFailure {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]SyncFailure(nil), r.failures...)
+}
+
+// Finish prints the recorded failures unless they are ignored, and
+// returns an error if the policy fails the build.
+func (r *SyncReport) Finish() error {
+	failures := r.Failures()
+	if len(failures) == 0 || r.Policy == SyncPolicyIgnore {
+		return nil
+	}
+
+	fmt.Printf("%d catalog entities failed to sync:\n", len(failures))
+	for _, f := range failures {
+		fmt.Printf("  %s: %v\n", f.Entity, f.Err)
+	}
+	if r.Policy == SyncPolicyFail {
+		return fmt.Errorf("%d catalog entities failed to sync", len(failures))
+	}
+	fmt.Println("catalog sync failures do not fail the build with the", r.Policy, "policy; set CATALOG_SYNC_POLICY=fail to enforce them")
+	return nil
+}
@@ -0,0 +1,36 @@
+package integrations
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSyncReport(t *testing.T) {
+	for _, tc := range []struct {
+		policy  string
+		wantErr bool
+	}{
+		{SyncPolicyIgnore, false},
+		{SyncPolicyWarn, false},
+		{SyncPolicyFail, true},
+	} {
+		r, err := NewSyncReport(tc.policy)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.policy, err)
+		}
+		r.Record("ok-app", nil)
+		r.Record("broken-app", errors.New("invalid owner"))
+		r.Record("other-app", errors.New("timeout"))
+
+		if got := len(r.Failures()); got != 2 {
+			t.Errorf("%s: expected 2 failures, got %d", tc.policy, got)
+		}
+		if err := r.Finish(); (err != nil) != tc.wantErr {
+			t.Errorf("%s: expected error %t, got %v", tc.policy, tc.wantErr, err)
+		}
+	}
+
+	if _, err := NewSyncReport("loud"); err == nil {
+		t.Error("expected an unknown policy to be rejected")
+	}
+}
@@ -0,0 +1,139 @@
+package integrations
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/Clever/ci-scripts/internal/environment"
+	"github.com/Clever/ci-scripts/internal/logger"
+	"github.com/Clever/ci-scripts/internal/retry"
+	"github.com/Clever/circle-ci-integrations/gen-go/client"
+	"github.com/Clever/circle-ci-integrations/gen-go/models"
+)
+
+// Authentication modes supported by circle-ci-integrations.
+const (
+	// AuthBasic authenticates with a username and password.
+	AuthBasic = "basic"
+	// AuthBearer authenticates with a static bearer token.
+	AuthBearer = "bearer"
+	// AuthOIDC authenticates with the OIDC token issued to the CI job.
+	AuthOIDC = "oidc"
+)
+
+// Config configures a circle-ci-integrations client.
+type Config struct {
+	// URL is the protocol and hostname of circle-ci-integrations.
+	URL  string
+	Auth Auth
+	// Retry is the retry and timeout policy of every request.
+	Retry retry.Policy
+}
+
+// Auth holds the credentials used to authenticate with
+// circle-ci-integrations. Only the fields of the mode are used.
+type Auth struct {
+	// Mode is one of AuthBasic, AuthBearer or AuthOIDC.
+	Mode     string
+	Username string
+	Password string
+	// Token is the bearer token. In AuthOIDC mode it is read from the
+	// environment on each request instead, as the token may be renewed
+	// during long running jobs.
+	Token string
+}
+
+// ConfigFromEnv builds the client configuration from the ci
+// environment.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		URL:   environment.CIIntegrationsURL(),
+		Auth:  Auth{Mode: environment.CIIntegrationsAuth()},
+		Retry: retry.NewPolicy(environment.RetryMaxElapsedTime()),
+	}
+	switch cfg.Auth.Mode {
+	case AuthBasic:
+		cfg.Auth.Username = environment.CIIntegrationsUser()
+		cfg.Auth.Password = environment.CIIntegrationsPassword()
+	case AuthBearer:
+		cfg.Auth.Token = environment.CIIntegrationsToken()
+	case AuthOIDC:
+	default:
+		return Config{}, fmt.Errorf("unknown circle-ci-integrations auth mode %q, expected %s, %s or %s", cfg.Auth.Mode, AuthBasic, AuthBearer, AuthOIDC)
+	}
+	return cfg, nil
+}
+
+// Client wraps the generated circle-ci-integrations client. Requests are
+// authenticated, retried according to the retry policy and logged with
+// any credentials redacted.
+type Client struct {
+	client.Client
+	// OnSync, if set, is called with the result of every catalog entity
+	// sync.
+	OnSync func(ctx context.Context, entity, syncType string, err error)
+}
+
+// New initializes a circle-ci-integrations client from the config.
+func New(cfg Config) *Client {
+	var rt http.RoundTripper = &retry.Transport{
+		Policy: cfg.Retry,
+		Base:   &authTransport{auth: cfg.Auth},
+	}
+	log := redactingLogger{
+		base:    logger.FmtPrinlnLogger{},
+		secrets: []string{cfg.Auth.Password, cfg.Auth.Token},
+	}
+	cli := client.New(cfg.URL, log, &rt)
+	cli.SetTimeout(cfg.Retry.Timeout())
+	return &Client{Client: cli}
+}
+
+// NewFromEnv initializes a circle-ci-integrations client configured by
+// the ci environment.
+func NewFromEnv() (*Client, error) {
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return New(cfg), nil
+}
+
+// SyncCatalogEntity syncs the entity to catalog-config. Entities are
+// only written on master, every other branch is a dry run which just
+// validates the entity.
+func (c *Client) SyncCatalogEntity(ctx context.Context, entity *models.SyncCatalogEntityInput) error {
+	branch := environment.Branch()
+	dryRun := branch != "master"
+	entity.Branch = &branch
+	entity.DryRun = &dryRun
+
+	fmt.Printf("Syncing catalog entity %s with type %s on branch %s with dry run %t\n", entity.Entity, entity.Type, branch, dryRun)
+	err := c.Client.SyncCatalogEntity(ctx, entity)
+	if err != nil {
+		err = fmt.Errorf("failed to sync catalog entity %s: %v", entity.Entity, err)
+	}
+	if c.OnSync != nil {
+		c.OnSync(ctx, entity.Entity, entity.Type, err)
+	}
+	return err
+}
+
+// authTransport wraps the default http transport, adding the configured
+// credentials to every request.
+type authTransport struct {
+	auth Auth
+}
+
+func (t *authTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	switch t.auth.Mode {
+	case AuthBasic:
+		r.SetBasicAuth(t.auth.Username, t.auth.Password)
+	case AuthBearer:
+		r.Header.Set("Authorization", "Bearer "+t.auth.Token)
+	case AuthOIDC:
+		r.Header.Set("Authorization", "Bearer "+environment.CircleOIDCToken())
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
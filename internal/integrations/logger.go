@@ -0,0 +1,54 @@
+package integrations
+
+import (
+	"strings"
+
+	"github.com/Clever/wag/logging/wagclientlogger"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are log fields which are always redacted.
+var sensitiveKeys = []string{"authorization", "password", "token", "secret"}
+
+// redactingLogger removes credentials from request logs before passing
+// them on to the base logger.
+type redactingLogger struct {
+	base    wagclientlogger.WagClientLogger
+	secrets []string
+}
+
+func (l redactingLogger) Log(level wagclientlogger.LogLevel, title string, data map[string]interface{}) {
+	l.base.Log(level, title, l.redact(data))
+}
+
+func (l redactingLogger) redact(data map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		out[k] = l.redactValue(k, v)
+	}
+	return out
+}
+
+func (l redactingLogger) redactValue(key string, v interface{}) interface{} {
+	lower := strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(lower, s) {
+			return redacted
+		}
+	}
+
+	switch v := v.(type) {
+	case string:
+		for _, s := range l.secrets {
+			if s != "" {
+				v = strings.ReplaceAll(v, s, redacted)
+			}
+		}
+		return v
+	case map[string]interface{}:
+		return l.redact(v)
+	default:
+		return v
+	}
+}
@@ -2,62 +2,239 @@ package lambda
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/Clever/ci-scripts/internal/environment"
 )
 
+const (
+	// sha256MetadataKey is the S3 object metadata key which holds the
+	// hex encoded SHA-256 of an uploaded artifact archive.
+	sha256MetadataKey = "sha256"
+	// Archives larger than uploadPartSize are uploaded in multiple
+	// parts, uploadConcurrency parts at a time.
+	uploadPartSize    = 16 * 1024 * 1024
+	uploadConcurrency = 4
+	// uploadMaxAttempts is the number of attempts the s3 client makes
+	// for each request, including each part of a multipart upload.
+	uploadMaxAttempts = 5
+)
+
 // Lambda wraps s3 to provide a simple API building and publishing lambdas.
 type Lambda struct {
-	awsCfg               aws.Config
-	artifactBucketPrefix string
+	awsCfg aws.Config
 }
 
 // New initializes a new Lambda handling wrapper with it's s3 client.
-func New(ctx context.Context, bucketPrefix string) *Lambda {
+func New(ctx context.Context) *Lambda {
 	return &Lambda{
-		awsCfg:               environment.AWSCfg(ctx, environment.OidcLambdaRole()),
-		artifactBucketPrefix: bucketPrefix,
+		awsCfg: environment.AWSCfg(ctx, environment.OidcLambdaRole()),
 	}
 }
 
 // Publish an already built lambda artifact archive to s3 using the
-// artifact name as the key. The archive is pushed to each of the aws
-// regions. Each region is pushed in it's own goroutine.
-func (l *Lambda) Publish(ctx context.Context, binaryPath, artifactName string) error {
+// artifact name as the key. The archive is pushed to each of the
+// regional buckets. Each region is pushed in it's own goroutine.
+//
+// Artifact keys contain the git sha and are never overwritten. If an
+// archive with the same SHA-256 already exists at the key the region is
+// skipped, which makes re-running a build safe. A different archive at
+// the key is an error.
+func (l *Lambda) Publish(ctx context.Context, binaryPath, artifactName string, buckets []Bucket) error {
+	return l.upload(ctx, binaryPath, s3Key(artifactName), buckets)
+}
+
+// upload an archive to the key in each of the regional buckets,
+// skipping any regions which already have an identical archive.
+func (l *Lambda) upload(ctx context.Context, binaryPath, key string, buckets []Bucket) error {
+	sums, err := fileChecksums(binaryPath)
+	if err != nil {
+		return fmt.Errorf("unable to read lambda artifact archive %s: %v", binaryPath, err)
+	}
+
 	grp, grpCtx := errgroup.WithContext(ctx)
-	for _, region := range environment.LambdaRegions {
-		region := region
-		bucket := fmt.Sprintf("%s-%s", l.artifactBucketPrefix, region)
-		key := s3Key(artifactName)
+	for _, b := range buckets {
+		region := b.Region
+		bucket := b.Name
 		s3uri := fmt.Sprintf("s3://%s/%s", bucket, key)
 
-		fmt.Println("uploading lambda artifact", binaryPath, "to", s3uri, "...")
-
 		grp.Go(func() error {
+			cfg := l.awsCfg.Copy()
+			cfg.Region = region
+			client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+				o.Retryer = retry.AddWithMaxAttempts(retry.NewStandard(), uploadMaxAttempts)
+			})
+
+			exists, err := identicalObjectExists(grpCtx, client, bucket, key, sums)
+			if err != nil {
+				return err
+			}
+			if exists {
+				fmt.Println("lambda artifact", s3uri, "already uploaded, skipping")
+				return nil
+			}
+
+			fmt.Println("uploading lambda artifact", binaryPath, "to", s3uri, "...")
+			start := time.Now()
 			f, err := os.Open(binaryPath)
 			if err != nil {
 				return fmt.Errorf("unable to open lambda artifact archive %s: %v", binaryPath, err)
 			}
-			cfg := l.awsCfg.Copy()
-			cfg.Region = region
+			defer f.Close()
 
-			_, err = s3.NewFromConfig(cfg).PutObject(grpCtx, &s3.PutObjectInput{
-				Bucket: aws.String(bucket),
-				Key:    aws.String(key),
-				Body:   f,
+			uploader := manager.NewUploader(client, func(u *manager.Uploader) {
+				u.PartSize = uploadPartSize
+				u.Concurrency = uploadConcurrency
+			})
+			_, err = uploader.Upload(grpCtx, &s3.PutObjectInput{
+				Bucket:   aws.String(bucket),
+				Key:      aws.String(key),
+				Body:     f,
+				Metadata: map[string]string{sha256MetadataKey: sums.sha256},
 			})
 			if err != nil {
 				return fmt.Errorf("failed to upload %s to %s: %v", binaryPath, s3uri, err)
 			}
+			fmt.Printf("uploaded %d bytes to %s (%s) in %s\n", sums.size, s3uri, region, time.Since(start).Round(time.Millisecond))
 			return nil
 		})
 	}
 
 	return grp.Wait()
 }
+
+// identicalObjectExists returns true if an object with a matching
+// SHA-256 already exists at the key, and false if there is no object at
+// the key. Objects uploaded before the SHA-256 was recorded are
+// identical if their ETag is the MD5 of the archive. Any other object at
+// the key results in an error.
+func identicalObjectExists(ctx context.Context, client *s3.Client, bucket, key string, sums checksums) (bool, error) {
+	out, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var nf *types.NotFound
+		if errors.As(err, &nf) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check for existing artifact s3://%s/%s: %v", bucket, key, headObjectError(err))
+	}
+
+	existing, ok := out.Metadata[sha256MetadataKey]
+	if !ok {
+		if strings.Trim(aws.ToString(out.ETag), `"`) == sums.md5 {
+			return true, nil
+		}
+		return false, fmt.Errorf(
+			"an artifact without a recorded sha256 already exists at s3://%s/%s and its ETag %s does not match the archive's MD5 %q; artifact keys are immutable and will not be overwritten",
+			bucket, key, aws.ToString(out.ETag), sums.md5,
+		)
+	}
+	if existing != sums.sha256 {
+		return false, fmt.Errorf(
+			"a different artifact already exists at s3://%s/%s (sha256 %q, expected %q); artifact keys are immutable and will not be overwritten",
+			bucket, key, existing, sums.sha256,
+		)
+	}
+	return true, nil
+}
+
+// headObjectError adds a hint to 403 HeadObject errors, which S3 also
+// returns for missing keys when the role lacks s3:ListBucket.
+func headObjectError(err error) error {
+	var re *awshttp.ResponseError
+	if errors.As(err, &re) && re.HTTPStatusCode() == http.StatusForbidden {
+		return fmt.Errorf("%v (access denied, check that the role has s3:GetObject and s3:ListBucket on the bucket)", err)
+	}
+	return err
+}
+
+// checksums are the hex encoded digests and size of an archive.
+type checksums struct {
+	sha256 string
+	md5    string
+	size   int64
+}
+
+// fileChecksums reads the file once, returning its checksums.
+func fileChecksums(path string) (checksums, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return checksums{}, err
+	}
+	defer f.Close()
+
+	sh, mh := sha256.New(), md5.New()
+	n, err := io.Copy(io.MultiWriter(sh, mh), f)
+	if err != nil {
+		return checksums{}, err
+	}
+	return checksums{
+		sha256: hex.EncodeToString(sh.Sum(nil)),
+		md5:    hex.EncodeToString(mh.Sum(nil)),
+		size:   n,
+	}, nil
+}
+
+// ArtifactExists returns an error unless the archive of the artifact
+// built at the revision is still in each of the regional buckets.
+func (l *Lambda) ArtifactExists(ctx context.Context, artifactName, revision string, buckets []Bucket) error {
+	key := s3KeyAt(artifactName, revision)
+	grp, grpCtx := errgroup.WithContext(ctx)
+	for _, b := range buckets {
+		grp.Go(func() error {
+			cfg := l.awsCfg.Copy()
+			cfg.Region = b.Region
+			_, err := s3.NewFromConfig(cfg).HeadObject(grpCtx, &s3.HeadObjectInput{
+				Bucket: aws.String(b.Name),
+				Key:    aws.String(key),
+			})
+			var nf *types.NotFound
+			if errors.As(err, &nf) {
+				return fmt.Errorf("lambda artifact s3://%s/%s no longer exists", b.Name, key)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to check for lambda artifact s3://%s/%s: %v", b.Name, key, headObjectError(err))
+			}
+			return nil
+		})
+	}
+	return grp.Wait()
+}
+
+// ArchiveDigest returns the digest of a built lambda archive, in the
+// same sha256:<hex> form as image digests.
+func ArchiveDigest(path string) (string, error) {
+	sums, err := fileChecksums(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read lambda artifact archive %s: %v", path, err)
+	}
+	return "sha256:" + sums.sha256, nil
+}
+
+// ArtifactURI returns the S3 URI of the artifact in the first of the
+// regional buckets it is uploaded to.
+func ArtifactURI(artifactName string, buckets []Bucket) string {
+	if len(buckets) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("s3://%s/%s", buckets[0].Name, s3Key(artifactName))
+}
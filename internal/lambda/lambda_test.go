@@ -0,0 +1,100 @@
+package lambda
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestIdenticalObjectExists(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "archive.zip")
+	if err := os.WriteFile(archive, []byte("lambda archive"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sums, err := fileChecksums(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		status  int
+		header  map[string]string
+		want    bool
+		wantErr string
+	}{
+		{name: "missing", status: http.StatusNotFound},
+		{
+			name:    "forbidden",
+			status:  http.StatusForbidden,
+			wantErr: "access denied, check that the role has s3:GetObject and s3:ListBucket",
+		},
+		{
+			name:   "identical",
+			status: http.StatusOK,
+			header: map[string]string{"x-amz-meta-sha256": sums.sha256, "ETag": `"` + sums.md5 + `"`},
+			want:   true,
+		},
+		{
+			name:    "different",
+			status:  http.StatusOK,
+			header:  map[string]string{"x-amz-meta-sha256": "0123", "ETag": `"` + sums.md5 + `"`},
+			wantErr: "a different artifact already exists",
+		},
+		{
+			name:   "identical without sha256",
+			status: http.StatusOK,
+			header: map[string]string{"ETag": `"` + sums.md5 + `"`},
+			want:   true,
+		},
+		{
+			name:    "different without sha256",
+			status:  http.StatusOK,
+			header:  map[string]string{"ETag": `"0123456789abcdef0123456789abcdef-2"`},
+			wantErr: "an artifact without a recorded sha256 already exists",
+		},
+		{
+			name:    "server error",
+			status:  http.StatusInternalServerError,
+			wantErr: "failed to check for existing artifact",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodHead || r.URL.Path != "/my-bucket/my-key" {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				}
+				for k, v := range tc.header {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(tc.status)
+			}))
+			defer srv.Close()
+			client := s3.New(s3.Options{
+				Region:       "us-west-2",
+				BaseEndpoint: aws.String(srv.URL),
+				UsePathStyle: true,
+				Credentials:  aws.AnonymousCredentials{},
+				Retryer:      aws.NopRetryer{},
+			})
+
+			got, err := identicalObjectExists(context.Background(), client, "my-bucket", "my-key", sums)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("expected error %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Errorf("expected %t, got %t, %v", tc.want, got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package lambda
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awslambda "github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Clever/catapult/gen-go/models"
+	"github.com/Clever/ci-scripts/internal/environment"
+	"github.com/Clever/ci-scripts/internal/manifest"
+	"github.com/Clever/ci-scripts/internal/repo"
+)
+
+// LayerTarget represents the information needed to build, upload and
+// optionally publish a lambda layer.
+type LayerTarget struct {
+	// Zip is the path to where the layer archive will be located on the
+	// local FS.
+	Zip string
+	// Command is the command to run to build the layer archive.
+	Command string
+	// Buckets are the regional buckets the layer archive is uploaded to.
+	Buckets []Bucket
+	// Publish is true if a layer version should be published in each
+	// region after upload.
+	Publish                 bool
+	CompatibleRuntimes      []string
+	CompatibleArchitectures []string
+}
+
+// LayerTargets returns the lambda layers declared in the launch configs
+// of the apps keyed by layer name. Layers are uploaded to the same
+// regional buckets as the apps declaring them. A layer may be declared
+// by multiple apps as long as the declarations are identical apart from
+// their regions.
+func LayerTargets(apps map[string]*models.LaunchConfig) (map[string]LayerTarget, error) {
+	names := make([]string, 0, len(apps))
+	for name := range apps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	targets := map[string]LayerTarget{}
+	for _, name := range names {
+		build, err := repo.ExtendedBuildConfig(name)
+		if err != nil {
+			return nil, err
+		}
+		if build.Lambda == nil || len(build.Lambda.Layers) == 0 {
+			continue
+		}
+		buckets, err := regionalBuckets(build.Lambda)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lambda configuration for %s: %v", name, err)
+		}
+
+		for _, layer := range build.Lambda.Layers {
+			if layer.Name == "" {
+				return nil, fmt.Errorf("lambda layer in %s is missing a name", name)
+			}
+			zip := layer.Zip
+			if zip == "" {
+				zip = fmt.Sprintf("./bin/%s.zip", layer.Name)
+			}
+			t := LayerTarget{
+				Zip:                     zip,
+				Command:                 layer.Command,
+				Buckets:                 buckets,
+				Publish:                 layer.Publish,
+				CompatibleRuntimes:      layer.CompatibleRuntimes,
+				CompatibleArchitectures: layer.CompatibleArchitectures,
+			}
+			// A layer shared by apps in different regions is uploaded to
+			// every region any of the apps run in.
+			if existing, ok := targets[layer.Name]; ok {
+				existingBuckets := existing.Buckets
+				existing.Buckets = nil
+				t.Buckets = nil
+				if !reflect.DeepEqual(existing, t) {
+					return nil, fmt.Errorf("lambda layer %s is declared differently by multiple apps", layer.Name)
+				}
+				if existing.Buckets, err = mergeBuckets(existingBuckets, buckets); err != nil {
+					return nil, fmt.Errorf("conflicting lambda configuration for layer %s in %s: %v", layer.Name, name, err)
+				}
+				targets[layer.Name] = existing
+				continue
+			}
+			targets[layer.Name] = t
+		}
+	}
+	return targets, nil
+}
+
+// PublishLayer uploads an already built layer archive to each of the
+// regional buckets. If the layer is configured to be published, a new
+// layer version is published from the archive in each region. A layer
+// version already published for this commit is reused rather than
+// published again. The uploaded archives and any layer versions are
+// returned for the build manifest.
+func (l *Lambda) PublishLayer(ctx context.Context, name string, t LayerTarget) ([]manifest.LayerVersion, error) {
+	key := layerS3Key(name)
+	if err := l.upload(ctx, t.Zip, key, t.Buckets); err != nil {
+		return nil, err
+	}
+
+	versions := make([]manifest.LayerVersion, len(t.Buckets))
+	for i, b := range t.Buckets {
+		versions[i] = manifest.LayerVersion{
+			Name:     name,
+			Region:   b.Region,
+			S3Bucket: b.Name,
+			S3Key:    key,
+		}
+	}
+	if !t.Publish {
+		return versions, nil
+	}
+
+	grp, grpCtx := errgroup.WithContext(ctx)
+	for i := range versions {
+		v := &versions[i]
+		grp.Go(func() error {
+			cfg := l.awsCfg.Copy()
+			cfg.Region = v.Region
+			arn, version, err := publishLayerVersion(grpCtx, awslambda.NewFromConfig(cfg), name, t, v.S3Bucket, v.S3Key)
+			if err != nil {
+				return fmt.Errorf("failed to publish lambda layer %s in %s: %v", name, v.Region, err)
+			}
+			fmt.Println("lambda layer", name, "version", version, "available in", v.Region, "as", arn)
+			v.Arn = arn
+			v.Version = version
+			return nil
+		})
+	}
+	if err := grp.Wait(); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// publishLayerVersion publishes a layer version from the archive, unless
+// the latest version of the layer was already published from this
+// commit.
+func publishLayerVersion(ctx context.Context, client *awslambda.Client, name string, t LayerTarget, bucket, key string) (string, int64, error) {
+	description := layerDescription()
+
+	existing, err := client.ListLayerVersions(ctx, &awslambda.ListLayerVersionsInput{
+		LayerName: aws.String(name),
+		MaxItems:  aws.Int32(1),
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	if len(existing.LayerVersions) > 0 {
+		latest := existing.LayerVersions[0]
+		if aws.ToString(latest.Description) == description {
+			return aws.ToString(latest.LayerVersionArn), latest.Version, nil
+		}
+	}
+
+	in := &awslambda.PublishLayerVersionInput{
+		LayerName:   aws.String(name),
+		Description: aws.String(description),
+		Content: &types.LayerVersionContentInput{
+			S3Bucket: aws.String(bucket),
+			S3Key:    aws.String(key),
+		},
+	}
+	for _, r := range t.CompatibleRuntimes {
+		in.CompatibleRuntimes = append(in.CompatibleRuntimes, types.Runtime(r))
+	}
+	for _, a := range t.CompatibleArchitectures {
+		in.CompatibleArchitectures = append(in.CompatibleArchitectures, types.Architecture(a))
+	}
+
+	out, err := client.PublishLayerVersion(ctx, in)
+	if err != nil {
+		return "", 0, err
+	}
+	return aws.ToString(out.LayerVersionArn), out.Version, nil
+}
+
+func layerS3Key(name string) string {
+	return fmt.Sprintf("layers/%[1]s/%[2]s/%[1]s.zip", name, environment.ShortSHA1())
+}
+
+// layerDescription identifies the commit a layer version was built
+// from.
+func layerDescription() string {
+	return fmt.Sprintf("github:Clever/%s@%s", environment.Repo(), environment.FullSHA1())
+}
@@ -0,0 +1,191 @@
+package lambda
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awslambda "github.com/aws/aws-sdk-go-v2/service/lambda"
+
+	"github.com/Clever/catapult/gen-go/models"
+)
+
+func TestLayerTargets(t *testing.T) {
+	// The environment is read once per process, so it matches
+	// TestRegionalBuckets.
+	t.Setenv("LAMBDA_AWS_REGIONS", "us-west-2,us-east-1")
+	t.Setenv("LAMBDA_AWS_BUCKET", "clever-lambdas")
+	t.Setenv("LAMBDA_AWS_BUCKET_TEMPLATE", "")
+
+	west := Bucket{Region: "us-west-2", Name: "clever-lambdas-us-west-2"}
+	east := Bucket{Region: "us-east-1", Name: "clever-lambdas-us-east-1"}
+	euWest := Bucket{Region: "eu-west-1", Name: "clever-lambdas-eu-west-1"}
+	layer := "      - name: deps\n        command: make layer\n        publish: true\n        compatibleRuntimes: [python3.12]\n"
+
+	for _, tc := range []struct {
+		name    string
+		launch  map[string]string
+		want    map[string]LayerTarget
+		wantErr string
+	}{
+		{
+			name:   "no layers",
+			launch: map[string]string{"api": "build:\n  lambda:\n    regions: [us-west-2]\n"},
+			want:   map[string]LayerTarget{},
+		},
+		{
+			name: "defaults",
+			launch: map[string]string{
+				"api": "build:\n  lambda:\n    layers:\n      - name: deps\n",
+			},
+			want: map[string]LayerTarget{
+				"deps": {Zip: "./bin/deps.zip", Buckets: []Bucket{west, east}},
+			},
+		},
+		{
+			name: "shared across regions",
+			launch: map[string]string{
+				"api":    "build:\n  lambda:\n    regions: [us-west-2]\n    layers:\n" + layer,
+				"worker": "build:\n  lambda:\n    regions: [eu-west-1, us-west-2]\n    layers:\n" + layer,
+			},
+			want: map[string]LayerTarget{
+				"deps": {
+					Zip:                "./bin/deps.zip",
+					Command:            "make layer",
+					Buckets:            []Bucket{west, euWest},
+					Publish:            true,
+					CompatibleRuntimes: []string{"python3.12"},
+				},
+			},
+		},
+		{
+			name: "declared differently",
+			launch: map[string]string{
+				"api":    "build:\n  lambda:\n    layers:\n" + layer,
+				"worker": "build:\n  lambda:\n    layers:\n      - name: deps\n        command: make other-layer\n",
+			},
+			wantErr: "lambda layer deps is declared differently by multiple apps",
+		},
+		{
+			name: "conflicting buckets",
+			launch: map[string]string{
+				"api":    "build:\n  lambda:\n    layers:\n" + layer,
+				"worker": "build:\n  lambda:\n    bucketTemplate: other-{region}\n    layers:\n" + layer,
+			},
+			wantErr: "conflicting lambda configuration for layer deps in worker",
+		},
+		{
+			name:    "missing name",
+			launch:  map[string]string{"api": "build:\n  lambda:\n    layers:\n      - command: make layer\n"},
+			wantErr: "lambda layer in api is missing a name",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			if err := os.Mkdir("launch", 0o755); err != nil {
+				t.Fatal(err)
+			}
+			apps := map[string]*models.LaunchConfig{}
+			for app, launch := range tc.launch {
+				if err := os.WriteFile(filepath.Join("launch", app+".yml"), []byte(launch), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				apps[app] = &models.LaunchConfig{}
+			}
+
+			got, err := LayerTargets(apps)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("expected error %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPublishLayerVersion(t *testing.T) {
+	t.Setenv("CIRCLE_PROJECT_REPONAME", "my-repo")
+	t.Setenv("CIRCLE_SHA1", "abc1234def5678")
+	description := "github:Clever/my-repo@abc1234def5678"
+
+	for _, tc := range []struct {
+		name        string
+		latest      string
+		wantArn     string
+		wantVersion int64
+		wantPublish bool
+	}{
+		{name: "first version", wantArn: "arn:deps:2", wantVersion: 2, wantPublish: true},
+		{name: "new commit", latest: "github:Clever/my-repo@0000000", wantArn: "arn:deps:2", wantVersion: 2, wantPublish: true},
+		{name: "already published", latest: description, wantArn: "arn:deps:1", wantVersion: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var published map[string]any
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/2018-10-31/layers/deps/versions" {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				switch r.Method {
+				case http.MethodGet:
+					var versions []map[string]any
+					if tc.latest != "" {
+						versions = append(versions, map[string]any{"LayerVersionArn": "arn:deps:1", "Version": 1, "Description": tc.latest})
+					}
+					json.NewEncoder(w).Encode(map[string]any{"LayerVersions": versions})
+				case http.MethodPost:
+					if err := json.NewDecoder(r.Body).Decode(&published); err != nil {
+						t.Errorf("invalid publish request: %v", err)
+					}
+					w.WriteHeader(http.StatusCreated)
+					json.NewEncoder(w).Encode(map[string]any{"LayerVersionArn": "arn:deps:2", "Version": 2})
+				}
+			}))
+			defer srv.Close()
+			client := awslambda.New(awslambda.Options{
+				Region:       "us-west-2",
+				BaseEndpoint: aws.String(srv.URL),
+				Credentials:  aws.AnonymousCredentials{},
+				Retryer:      aws.NopRetryer{},
+			})
+
+			target := LayerTarget{CompatibleRuntimes: []string{"python3.12"}, CompatibleArchitectures: []string{"arm64"}}
+			arn, version, err := publishLayerVersion(context.Background(), client, "deps", target, "my-bucket", "layers/deps/abc1234/deps.zip")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if arn != tc.wantArn || version != tc.wantVersion {
+				t.Errorf("expected %s version %d, got %s version %d", tc.wantArn, tc.wantVersion, arn, version)
+			}
+			if !tc.wantPublish {
+				if published != nil {
+					t.Errorf("expected the existing version to be reused, published %v", published)
+				}
+				return
+			}
+			want := map[string]any{
+				"Description":             description,
+				"Content":                 map[string]any{"S3Bucket": "my-bucket", "S3Key": "layers/deps/abc1234/deps.zip"},
+				"CompatibleRuntimes":      []any{"python3.12"},
+				"CompatibleArchitectures": []any{"arm64"},
+			}
+			if !reflect.DeepEqual(published, want) {
+				t.Errorf("expected to publish %v, published %v", want, published)
+			}
+		})
+	}
+}
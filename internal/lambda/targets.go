@@ -18,6 +18,16 @@ type LambdaTarget struct {
 	Zip string
 	// Command is the command to run to build the lambda artifact
 	Command string
+	// Buckets are the regional buckets the lambda artifact is uploaded
+	// to.
+	Buckets []Bucket
+}
+
+// Bucket is an S3 bucket in a specific region which lambda artifacts
+// are uploaded to.
+type Bucket struct {
+	Region string
+	Name   string
 }
 
 // BuildTargets returns a set of lambda targets to build and publish to
@@ -26,10 +36,9 @@ type LambdaTarget struct {
 // destination zip file in the value struct. Any apps with a shared
 // artifact will have only one entry in the map, but will still have
 // individual entries in the catapult build artifacts
-func BuildTargets(apps map[string]*models.LaunchConfig) (map[string]LambdaTarget, []*catapult.Artifact) {
+func BuildTargets(apps map[string]*models.LaunchConfig) (map[string]LambdaTarget, []*catapult.Artifact, error) {
 	var (
 		targets   = map[string]LambdaTarget{}
-		done      = map[string]struct{}{}
 		artifacts []*catapult.Artifact
 	)
 
@@ -38,36 +47,124 @@ func BuildTargets(apps map[string]*models.LaunchConfig) (map[string]LambdaTarget
 			continue
 		}
 
+		buckets, err := AppBuckets(name)
+		if err != nil {
+			return nil, nil, err
+		}
+
 		artifact := repo.ArtifactName(name, launch)
 		artifacts = append(artifacts, &catapult.Artifact{
 			RunType:   string(models.RunTypeLambda),
 			ID:        name,
 			Branch:    environment.Branch(),
 			Source:    fmt.Sprintf("github:Clever/%s@%s", environment.Repo(), environment.FullSHA1()),
-			Artifacts: fmt.Sprintf("lambda:clever/%s@%s;S3Key=\"%s,%s", artifact, environment.ShortSHA1(), s3Key(artifact), s3Buckets()),
+			Artifacts: fmt.Sprintf("lambda:clever/%s@%s;S3Key=\"%s,%s", artifact, environment.ShortSHA1(), s3Key(artifact), s3Buckets(buckets)),
 		})
 
-		if _, ok := done[artifact]; ok {
+		// Apps sharing an artifact are built once, but the artifact must
+		// be uploaded to every region any of the apps run in.
+		if t, ok := targets[artifact]; ok {
 			fmt.Println(name, "shares artifact with", artifact)
+			if t.Buckets, err = mergeBuckets(t.Buckets, buckets); err != nil {
+				return nil, nil, fmt.Errorf("conflicting lambda configuration for %s: %v", name, err)
+			}
+			targets[artifact] = t
 			continue
 		}
-		done[artifact] = struct{}{}
 		targets[artifact] = LambdaTarget{
 			Zip:     fmt.Sprintf("./bin/%s.zip", artifact),
 			Command: repo.BuildCommand(launch),
+			Buckets: buckets,
 		}
 	}
-	return targets, artifacts
+	return targets, artifacts, nil
+}
+
+// AppBuckets returns the regional buckets the app's lambda artifact is
+// uploaded to.
+func AppBuckets(app string) ([]Bucket, error) {
+	build, err := repo.ExtendedBuildConfig(app)
+	if err != nil {
+		return nil, err
+	}
+	buckets, err := regionalBuckets(build.Lambda)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lambda configuration for %s: %v", app, err)
+	}
+	return buckets, nil
+}
+
+// regionalBuckets resolves the regions and bucket names for a lambda
+// from its launch config, falling back to the environment for anything
+// not configured per app.
+func regionalBuckets(cfg *repo.LambdaBuild) ([]Bucket, error) {
+	if cfg == nil {
+		cfg = &repo.LambdaBuild{}
+	}
+	regions := cfg.Regions
+	if len(regions) == 0 {
+		regions = environment.LambdaRegions()
+	}
+	tmpl := cfg.BucketTemplate
+	if tmpl == "" {
+		tmpl = environment.LambdaBucketTemplate()
+	}
+
+	prefix := ""
+	if strings.Contains(tmpl, "{prefix}") {
+		prefix = environment.LambdaArtifactBucketPrefix()
+	}
+
+	var (
+		out  []Bucket
+		seen = map[string]string{}
+	)
+	for _, region := range regions {
+		name := strings.NewReplacer("{prefix}", prefix, "{region}", region).Replace(tmpl)
+		if other, ok := seen[name]; ok {
+			return nil, fmt.Errorf("regions %s and %s both resolve to bucket %s", other, region, name)
+		}
+		seen[name] = region
+		out = append(out, Bucket{Region: region, Name: name})
+	}
+	return out, nil
+}
+
+// mergeBuckets adds any regions in b which are missing from a. It is an
+// error for the same region to resolve to different buckets.
+func mergeBuckets(a, b []Bucket) ([]Bucket, error) {
+	out := append([]Bucket{}, a...)
+	for _, nb := range b {
+		found := false
+		for _, ob := range a {
+			if ob.Region != nb.Region {
+				continue
+			}
+			if ob.Name != nb.Name {
+				return nil, fmt.Errorf("region %s resolves to both %s and %s", nb.Region, ob.Name, nb.Name)
+			}
+			found = true
+		}
+		if !found {
+			out = append(out, nb)
+		}
+	}
+	return out, nil
 }
 
 func s3Key(artifactName string) string {
-	return fmt.Sprintf("%[1]s/%[2]s/%[1]s.zip", artifactName, environment.ShortSHA1())
+	return s3KeyAt(artifactName, environment.ShortSHA1())
+}
+
+// s3KeyAt is the key of the artifact built at the revision.
+func s3KeyAt(artifactName, revision string) string {
+	return fmt.Sprintf("%[1]s/%[2]s/%[1]s.zip", artifactName, revision)
 }
 
-func s3Buckets() string {
+func s3Buckets(buckets []Bucket) string {
 	out := []string{}
-	for _, r := range environment.LambdaRegions {
-		out = append(out, fmt.Sprintf("S3Buckets={%[1]s=\"%[2]s-%[1]s", r, environment.LambdaArtifactBucketPrefix()))
+	for _, b := range buckets {
+		out = append(out, fmt.Sprintf("S3Buckets={%s=\"%s", b.Region, b.Name))
 	}
 	return strings.Join(out, ",")
 }
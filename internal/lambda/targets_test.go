@@ -0,0 +1,99 @@
+package lambda
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Clever/ci-scripts/internal/repo"
+)
+
+func TestRegionalBuckets(t *testing.T) {
+	// The environment is read once per process, so every case shares it.
+	t.Setenv("LAMBDA_AWS_REGIONS", "us-west-2,us-east-1")
+	t.Setenv("LAMBDA_AWS_BUCKET", "clever-lambdas")
+	t.Setenv("LAMBDA_AWS_BUCKET_TEMPLATE", "")
+
+	for _, tc := range []struct {
+		name    string
+		cfg     *repo.LambdaBuild
+		want    []Bucket
+		wantErr string
+	}{
+		{
+			name: "environment",
+			want: []Bucket{{Region: "us-west-2", Name: "clever-lambdas-us-west-2"}, {Region: "us-east-1", Name: "clever-lambdas-us-east-1"}},
+		},
+		{
+			name: "app regions",
+			cfg:  &repo.LambdaBuild{Regions: []string{"eu-west-1"}},
+			want: []Bucket{{Region: "eu-west-1", Name: "clever-lambdas-eu-west-1"}},
+		},
+		{
+			name: "app bucket template",
+			cfg:  &repo.LambdaBuild{BucketTemplate: "my-app-{region}"},
+			want: []Bucket{{Region: "us-west-2", Name: "my-app-us-west-2"}, {Region: "us-east-1", Name: "my-app-us-east-1"}},
+		},
+		{
+			name: "app regions and bucket template",
+			cfg:  &repo.LambdaBuild{Regions: []string{"us-east-2"}, BucketTemplate: "{prefix}-{region}-shared"},
+			want: []Bucket{{Region: "us-east-2", Name: "clever-lambdas-us-east-2-shared"}},
+		},
+		{
+			name:    "regions resolving to the same bucket",
+			cfg:     &repo.LambdaBuild{BucketTemplate: "my-app-artifacts"},
+			wantErr: "regions us-west-2 and us-east-1 both resolve to bucket my-app-artifacts",
+		},
+	} {
+		got, err := regionalBuckets(tc.cfg)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%s: expected error %q, got %v", tc.name, tc.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestMergeBuckets(t *testing.T) {
+	west := Bucket{Region: "us-west-2", Name: "lambdas-us-west-2"}
+	east := Bucket{Region: "us-east-1", Name: "lambdas-us-east-1"}
+	for _, tc := range []struct {
+		name    string
+		a, b    []Bucket
+		want    []Bucket
+		wantErr string
+	}{
+		{name: "disjoint regions", a: []Bucket{west}, b: []Bucket{east}, want: []Bucket{west, east}},
+		{name: "duplicate regions", a: []Bucket{west, east}, b: []Bucket{east, west}, want: []Bucket{west, east}},
+		{name: "nothing to add", a: []Bucket{west}, want: []Bucket{west}},
+		{
+			name:    "conflicting buckets",
+			a:       []Bucket{west},
+			b:       []Bucket{{Region: "us-west-2", Name: "other-us-west-2"}},
+			wantErr: "region us-west-2 resolves to both lambdas-us-west-2 and other-us-west-2",
+		},
+	} {
+		got, err := mergeBuckets(tc.a, tc.b)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%s: expected error %q, got %v", tc.name, tc.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
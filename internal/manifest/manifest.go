@@ -0,0 +1,45 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Manifest records the outputs of a goci build which are not tracked
+// by catapult, so that later CI steps and applications can reference
+// them.
+type Manifest struct {
+	// Layers are the lambda layer versions published by the build.
+	Layers []LayerVersion `json:"layers,omitempty"`
+}
+
+// LayerVersion is a lambda layer archive uploaded to a single region,
+// along with the layer version published from it if any.
+type LayerVersion struct {
+	Name     string `json:"name"`
+	Region   string `json:"region"`
+	S3Bucket string `json:"s3Bucket"`
+	S3Key    string `json:"s3Key"`
+	// Arn and Version are empty when the layer is only uploaded.
+	Arn     string `json:"arn,omitempty"`
+	Version int64  `json:"version,omitempty"`
+}
+
+// Write the manifest as indented JSON to path, creating any missing
+// parent directories.
+func (m *Manifest) Write(path string) error {
+	bs, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal build manifest: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create build manifest directory: %v", err)
+	}
+	if err := os.WriteFile(path, bs, 0o644); err != nil {
+		return fmt.Errorf("failed to write build manifest %s: %v", path, err)
+	}
+	fmt.Println("wrote build manifest to", path)
+	return nil
+}
@@ -0,0 +1,61 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestWrite(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		manifest Manifest
+		want     string
+	}{
+		{
+			name:     "no layers",
+			manifest: Manifest{},
+			want:     "{}",
+		},
+		{
+			name: "uploaded and published layers",
+			manifest: Manifest{Layers: []LayerVersion{
+				{Name: "deps", Region: "us-west-2", S3Bucket: "lambdas-us-west-2", S3Key: "layers/deps/abc1234/deps.zip", Arn: "arn:deps:2", Version: 2},
+				{Name: "assets", Region: "us-west-2", S3Bucket: "lambdas-us-west-2", S3Key: "layers/assets/abc1234/assets.zip"},
+			}},
+			want: `{
+  "layers": [
+    {
+      "name": "deps",
+      "region": "us-west-2",
+      "s3Bucket": "lambdas-us-west-2",
+      "s3Key": "layers/deps/abc1234/deps.zip",
+      "arn": "arn:deps:2",
+      "version": 2
+    },
+    {
+      "name": "assets",
+      "region": "us-west-2",
+      "s3Bucket": "lambdas-us-west-2",
+      "s3Key": "layers/assets/abc1234/assets.zip"
+    }
+  ]
+}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Missing parent directories are created.
+			path := filepath.Join(t.TempDir(), "bin", "goci-manifest.json")
+			if err := tc.manifest.Write(path); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			bs, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(bs) != tc.want {
+				t.Errorf("expected manifest:\n%s\ngot:\n%s", tc.want, bs)
+			}
+		})
+	}
+}
@@ -2,88 +2,242 @@ package platformevents
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 
+	"github.com/Clever/ci-scripts/internal/deploy"
 	"github.com/Clever/ci-scripts/internal/environment"
 	"github.com/Clever/ci-scripts/internal/platformevents/schemas/deploycreated"
 	"github.com/Clever/ci-scripts/internal/repo"
-	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
-	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
 )
 
-const (
-	eventBridgeName  = "production--platform-events"
-	deployDetailType = "deploy.created"
-	source           = "circle-ci"
-)
+const deployDetailType = "deploy.created"
 
 type DeployPublisher struct {
-	client *eventbridge.Client
+	*Publisher
+	// Gate, if set, holds deploys to its gated environments until they
+	// are approved.
+	Gate *deploy.Gate
+	// Overrides, if set, returns the overrides of each deploy in place of
+	// those in config/<app>/stack.yaml.
+	Overrides func(deploy.Target) (*repo.DeployOverrides, error)
 }
 
-
-func NewDeployPublisher(ctx context.Context) *DeployPublisher {
-	cfg := environment.AWSCfg(ctx, environment.OidcEventBridgeRole())
-	return &DeployPublisher{
-		client: eventbridge.NewFromConfig(cfg),
+func NewDeployPublisher(ctx context.Context) (*DeployPublisher, error) {
+	p, err := NewPublisher(ctx)
+	if err != nil {
+		return nil, err
 	}
+	return &DeployPublisher{Publisher: p}, nil
 }
 
-func (d *DeployPublisher) DeployApps(ctx context.Context, apps []string) error {
+// DeployApps publishes a deploy event of the current build for each app
+// to each of its environments in envs. See Deploy.
+func (d *DeployPublisher) DeployApps(ctx context.Context, apps []string, envs map[string][]string, runner deploy.Runner) ([]deploy.Target, *deploy.Summary, error) {
+	targets := []deploy.Target{}
 	for _, app := range apps {
-		envs, err := repo.AutoDeployEnvs(app)
+		for _, env := range envs[app] {
+			targets = append(targets, deploy.Target{App: app, Environment: env, Revision: environment.ShortSHA1()})
+		}
+	}
+	summary, err := d.Deploy(ctx, targets, runner)
+	return targets, summary, err
+}
+
+// Deploy publishes a deploy event of the revision of each target, along
+// with any overrides configured for its environment. The events are
+// published by the runner in batches of up to 10 events, and the result
+// of each deploy is returned in the summary. Deploys to gated
+// environments are only published once approved, with the approver as
+// the user of the event.
+func (d *DeployPublisher) Deploy(ctx context.Context, targets []deploy.Target, runner deploy.Runner) (*deploy.Summary, error) {
+	var (
+		events    = map[deploy.Target]deployEvent{}
+		commits   = map[string]*repo.Commit{}
+		overrides = d.Overrides
+	)
+	if overrides == nil {
+		overrides = func(t deploy.Target) (*repo.DeployOverrides, error) {
+			return repo.DeployOverridesFor(t.App, t.Environment)
+		}
+	}
+	for _, t := range targets {
+		commit, ok := commits[t.Revision]
+		if !ok {
+			var err error
+			if commit, err = repo.ReadCommit(t.Revision); err != nil {
+				fmt.Printf("failed to read commit %s, its deploy events will not include it: %v\n", t.Revision, err)
+			}
+			commits[t.Revision] = commit
+		}
+		o, err := overrides(t)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		for _, env := range envs {
-			err := d.deployApp(ctx, app, env)
+		event := deployDetail(t, commit)
+		event.Overrides = eventOverrides(o)
+		events[t] = event
+	}
+
+	// Gated deploys wait for approval before they are batched, so that
+	// they never hold up other deploys, and are attributed to whoever
+	// approved them.
+	var mu sync.Mutex
+	if d.Gate != nil {
+		runner.Gated = func(t deploy.Target) bool { return d.Gate.Gated(t.Environment) }
+		runner.Approve = func(ctx context.Context, t deploy.Target) error {
+			a, err := d.Gate.Wait(ctx, t)
 			if err != nil {
 				return err
 			}
+			mu.Lock()
+			defer mu.Unlock()
+			event := events[t]
+			event.User = deploycreated.User{GithubUsername: strPtr(a.Approver)}
+			if a.Email != "" {
+				event.User.Email = strPtr(a.Email)
+			}
+			events[t] = event
+			return nil
 		}
 	}
-	return nil
+
+	return runner.RunBatches(ctx, targets, maxPutEventsEntries, func(ctx context.Context, batch []deploy.Target) []error {
+		mu.Lock()
+		details := make([]deployEvent, len(batch))
+		for i, t := range batch {
+			details[i] = events[t]
+		}
+		mu.Unlock()
+		return d.deployBatch(ctx, batch, details)
+	})
 }
 
-func (d *DeployPublisher) deployApp(ctx context.Context, app, env string) error {
-	buildID := environment.ShortSHA1()
-	repoName := environment.Repo()
-	githubUser := environment.CircleTriggeredBy()
-	clusterEnvironment := getClusterEnvironment(env)
+// deployBatch publishes the deploy event of each target in a single
+// delivery to the sink. Events which fail schema validation are not
+// sent. The details and returned errors are index-aligned with the
+// targets.
+func (d *DeployPublisher) deployBatch(ctx context.Context, targets []deploy.Target, details []deployEvent) []error {
+	var (
+		errs   = make([]error, len(targets))
+		events []Event
+		sent   []int
+	)
+	for i, t := range targets {
+		event := details[i]
+		fmt.Println("Deploying", t.App, "to", t.Environment, "with build ID", event.TargetRevision)
 
-	fmt.Println("Deploying", app, "to", env, "with build ID", buildID)
+		e, err := newEvent(deployDetailType, event)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		events = append(events, e)
+		sent = append(sent, i)
+	}
+	if len(events) == 0 {
+		return errs
+	}
 
-	event := deploycreated.Detail{
-		App:                app,
-		Repo:               repoName,
-		User:               deploycreated.User{GithubUsername: strPtr(githubUser)},
-		Environment:        env,
-		TargetRevision:     buildID,
-		ClusterEnvironment: clusterEnvironment,
+	for n, err := range d.sink.Put(ctx, events) {
+		errs[sent[n]] = err
 	}
+	return errs
+}
 
-	detail, err := json.Marshal(event)
-	if err != nil {
-		return fmt.Errorf("failed to marshal deploy event: %w", err)
-	}
-
-	_, err = d.client.PutEvents(ctx, &eventbridge.PutEventsInput{
-		Entries: []types.PutEventsRequestEntry{
-			{
-				EventBusName: strPtr(eventBridgeName),
-				DetailType:   strPtr(deployDetailType),
-				Source:       strPtr(source),
-				Detail:       strPtr(string(detail)),
-			},
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("failed to put event to EventBridge: %w", err)
+// deployEvent is a deploy.created detail along with goci's extensions,
+// which the registry schema does not describe.
+type deployEvent struct {
+	deploycreated.Detail
+	Extensions *deployExtensions `json:"extensions,omitempty"`
+}
+
+type deployExtensions struct {
+	Commit commitExtension `json:"commit"`
+}
+
+// commitExtension is the commit being deployed.
+type commitExtension struct {
+	Sha         string `json:"sha"`
+	Author      string `json:"author"`
+	AuthorEmail string `json:"authorEmail,omitempty"`
+	Summary     string `json:"summary"`
+}
+
+// deployDetail builds the deploy.created event of deploying the target,
+// which is at the commit if it could be read.
+func deployDetail(t deploy.Target, commit *repo.Commit) deployEvent {
+	event := deployEvent{Detail: deploycreated.Detail{
+		App:                t.App,
+		Repo:               environment.Repo(),
+		User:               deployUser(environment.CircleTriggeredBy(), commit),
+		Environment:        t.Environment,
+		TargetRevision:     t.Revision,
+		ClusterEnvironment: getClusterEnvironment(t.Environment),
+	}}
+	if commit != nil {
+		event.Extensions = &deployExtensions{Commit: commitExtension{
+			Sha:         commit.SHA,
+			Author:      commit.Author,
+			AuthorEmail: commit.AuthorEmail,
+			Summary:     commit.Summary,
+		}}
 	}
+	return event
+}
 
-	return nil
+// deployUser attributes a deploy to the user who triggered the build.
+// Builds no user triggered, such as scheduled pipelines, are attributed
+// to the author of the commit, by their GitHub username if their email
+// is a GitHub noreply address. The author's email is only included if
+// the author is the user the deploy is attributed to.
+func deployUser(triggeredBy string, commit *repo.Commit) deploycreated.User {
+	var user deploycreated.User
+	if triggeredBy != "" {
+		user.GithubUsername = strPtr(triggeredBy)
+	}
+	if commit == nil || commit.AuthorEmail == "" {
+		return user
+	}
+	login := commit.GithubLogin()
+	switch {
+	case triggeredBy == "":
+		if login != "" {
+			user.GithubUsername = strPtr(login)
+		}
+		user.Email = strPtr(commit.AuthorEmail)
+	case strings.EqualFold(login, triggeredBy) || strings.EqualFold(commit.Author, triggeredBy):
+		user.Email = strPtr(commit.AuthorEmail)
+	}
+	return user
+}
+
+// eventOverrides converts stack config overrides to their event form,
+// or nil if there are none. Env vars are sorted by name so events are
+// stable.
+func eventOverrides(o *repo.DeployOverrides) *deploycreated.DeployOverrides {
+	if o == nil || (len(o.Env) == 0 && o.Autoscaling == nil) {
+		return nil
+	}
+	out := &deploycreated.DeployOverrides{}
+	if len(o.Env) > 0 {
+		names := make([]string, 0, len(o.Env))
+		for name := range o.Env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		env := make([]deploycreated.EnvVarOverride, len(names))
+		for i, name := range names {
+			env[i] = deploycreated.EnvVarOverride{Name: name, Value: o.Env[name]}
+		}
+		out.Env = &env
+	}
+	if o.Autoscaling != nil {
+		out.Autoscaling = &deploycreated.AutoScalingConfig{Min: o.Autoscaling.Min, Max: o.Autoscaling.Max}
+	}
+	return out
 }
 
 func strPtr(s string) *string {
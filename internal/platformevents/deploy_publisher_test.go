@@ -0,0 +1,108 @@
+package platformevents
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Clever/ci-scripts/internal/deploy"
+	"github.com/Clever/ci-scripts/internal/repo"
+)
+
+func TestDeployAppsGated(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("CIRCLE_PROJECT_REPONAME", "my-test-repo")
+	t.Setenv("CIRCLE_SHA1", "abc1234def5678")
+	t.Setenv("CIRCLE_USERNAME", "committer")
+
+	approvals := filepath.Join(t.TempDir(), "approvals")
+	if err := os.MkdirAll(approvals, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	approved := `{"app": "app-a", "environment": "production", "revision": "abc1234", "state": "approved", "approver": "octocat", "email": "octocat@example.com"}`
+	if err := os.WriteFile(filepath.Join(approvals, "app-a-production.json"), []byte(approved), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	d := &DeployPublisher{
+		Publisher: &Publisher{sink: &FileSink{Path: path, Source: "circle-ci"}},
+		Gate: &deploy.Gate{
+			Approver:     &deploy.FileApprover{Dir: approvals},
+			Environments: []string{"production"},
+			Interval:     time.Millisecond,
+			Timeout:      50 * time.Millisecond,
+		},
+	}
+	envs := map[string][]string{
+		"app-a": {"clever-dev", "production"},
+		"app-b": {"production"},
+	}
+	_, summary, err := d.DeployApps(context.Background(), []string{"app-a", "app-b"}, envs, deploy.Runner{KeepGoing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range summary.Results {
+		wantFailed := r.App == "app-b"
+		if (r.Outcome == deploy.OutcomeFailed) != wantFailed || (wantFailed && !strings.Contains(r.Reason, "timed out waiting for approval")) {
+			t.Errorf("unexpected result %+v", r)
+		}
+	}
+
+	users := map[string]string{}
+	for _, e := range readEvents(t, path) {
+		var detail struct {
+			App, Environment string
+			User             struct{ GithubUsername, Email string }
+		}
+		if err := json.Unmarshal(e.Detail, &detail); err != nil {
+			t.Fatal(err)
+		}
+		users[detail.App+" to "+detail.Environment] = detail.User.GithubUsername + " " + detail.User.Email
+	}
+	want := map[string]string{
+		"app-a to clever-dev": "committer ",
+		"app-a to production": "octocat octocat@example.com",
+	}
+	if len(users) != len(want) || users["app-a to clever-dev"] != want["app-a to clever-dev"] || users["app-a to production"] != want["app-a to production"] {
+		t.Errorf("expected deploys by %v, got %v", want, users)
+	}
+}
+
+func TestDeployUser(t *testing.T) {
+	noreply := &repo.Commit{Author: "The Octocat", AuthorEmail: "1234+octocat@users.noreply.github.com"}
+	work := &repo.Commit{Author: "octocat", AuthorEmail: "octocat@example.com"}
+	other := &repo.Commit{Author: "someone", AuthorEmail: "someone@example.com"}
+
+	for _, tc := range []struct {
+		name        string
+		triggeredBy string
+		commit      *repo.Commit
+		wantUser    string
+		wantEmail   string
+	}{
+		{name: "triggered by the author", triggeredBy: "octocat", commit: noreply, wantUser: "octocat", wantEmail: noreply.AuthorEmail},
+		{name: "triggered by the author by name", triggeredBy: "octocat", commit: work, wantUser: "octocat", wantEmail: work.AuthorEmail},
+		{name: "triggered by someone else", triggeredBy: "octocat", commit: other, wantUser: "octocat"},
+		{name: "scheduled", commit: noreply, wantUser: "octocat", wantEmail: noreply.AuthorEmail},
+		{name: "scheduled without a GitHub email", commit: other, wantEmail: other.AuthorEmail},
+		{name: "unknown commit", triggeredBy: "octocat", wantUser: "octocat"},
+		{name: "nothing known"},
+	} {
+		u := deployUser(tc.triggeredBy, tc.commit)
+		var user, email string
+		if u.GithubUsername != nil {
+			user = *u.GithubUsername
+		}
+		if u.Email != nil {
+			email = *u.Email
+		}
+		if user != tc.wantUser || email != tc.wantEmail {
+			t.Errorf("%s: expected %q <%s>, got %q <%s>", tc.name, tc.wantUser, tc.wantEmail, user, email)
+		}
+	}
+}
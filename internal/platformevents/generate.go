@@ -1,6 +1,25 @@
 package platformevents
 
-// Regenerates the deploy.created Go bindings from the EventBridge Schema
-// Registry. Requires AWS credentials with schema registry read access; skips
-// when CI=true
+// Regenerates the Go bindings of every published event from the
+// EventBridge Schema Registry. Requires AWS credentials with schema
+// registry read access; skips when CI=true
+//
+// The registry directory holds the schema of each build lifecycle event,
+// which is published to the registry alongside the event's first
+// release. Until then, the bindings of those events are generated from
+// the files with oapi-codegen, which schemabindings runs on the schemas
+// it fetches, and validate_gen.go, which writes the same validators as
+// schemabindings, so no credentials are needed for them.
 //go:generate go tool github.com/Clever/slingshot/cmd/schemabindings -registry arn:aws:schemas:us-west-2:605134456190:registry/clever-events -schema deploy.created -out ./schemas/deploycreated/deploycreated.gen.go -region us-west-2
+//go:generate go tool github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen -generate types,spec -package buildstarted -o ./schemas/buildstarted/buildstarted.gen.go ./registry/build.started.json
+//go:generate go tool github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen -generate types,spec -package artifactbuilt -o ./schemas/artifactbuilt/artifactbuilt.gen.go ./registry/artifact.built.json
+//go:generate go tool github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen -generate types,spec -package artifactpublished -o ./schemas/artifactpublished/artifactpublished.gen.go ./registry/artifact.published.json
+//go:generate go tool github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen -generate types,spec -package buildcompleted -o ./schemas/buildcompleted/buildcompleted.gen.go ./registry/build.completed.json
+//go:generate go tool github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen -generate types,spec -package buildfailed -o ./schemas/buildfailed/buildfailed.gen.go ./registry/build.failed.json
+//go:generate go tool github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen -generate types,spec -package catalogsynced -o ./schemas/catalogsynced/catalogsynced.gen.go ./registry/catalog.synced.json
+//go:generate go run validate_gen.go -package buildstarted -o ./schemas/buildstarted/buildstarted.gen_validate.go ./registry/build.started.json
+//go:generate go run validate_gen.go -package artifactbuilt -o ./schemas/artifactbuilt/artifactbuilt.gen_validate.go ./registry/artifact.built.json
+//go:generate go run validate_gen.go -package artifactpublished -o ./schemas/artifactpublished/artifactpublished.gen_validate.go ./registry/artifact.published.json
+//go:generate go run validate_gen.go -package buildcompleted -o ./schemas/buildcompleted/buildcompleted.gen_validate.go ./registry/build.completed.json
+//go:generate go run validate_gen.go -package buildfailed -o ./schemas/buildfailed/buildfailed.gen_validate.go ./registry/build.failed.json
+//go:generate go run validate_gen.go -package catalogsynced -o ./schemas/catalogsynced/catalogsynced.gen_validate.go ./registry/catalog.synced.json
@@ -0,0 +1,174 @@
+package platformevents
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Clever/ci-scripts/internal/environment"
+	"github.com/Clever/ci-scripts/internal/platformevents/schemas/artifactbuilt"
+	"github.com/Clever/ci-scripts/internal/platformevents/schemas/artifactpublished"
+	"github.com/Clever/ci-scripts/internal/platformevents/schemas/buildcompleted"
+	"github.com/Clever/ci-scripts/internal/platformevents/schemas/buildfailed"
+	"github.com/Clever/ci-scripts/internal/platformevents/schemas/buildstarted"
+	"github.com/Clever/ci-scripts/internal/platformevents/schemas/catalogsynced"
+)
+
+// Detail types of the build lifecycle events.
+const (
+	buildStartedDetailType      = "build.started"
+	artifactBuiltDetailType     = "artifact.built"
+	artifactPublishedDetailType = "artifact.published"
+	buildCompletedDetailType    = "build.completed"
+	buildFailedDetailType       = "build.failed"
+	catalogSyncedDetailType     = "catalog.synced"
+)
+
+// Artifact types reported in artifact events.
+const (
+	ArtifactDocker = "docker"
+	ArtifactLambda = "lambda"
+	ArtifactLayer  = "lambda-layer"
+	ArtifactSpark  = "spark"
+	ArtifactStatic = "static"
+)
+
+// Artifact identifies a build artifact in artifact events.
+type Artifact struct {
+	Name string
+	// Type is one of the Artifact* types.
+	Type string
+	// Reference locates the artifact, such as an image tag or S3 URI.
+	Reference string
+	// Digest is the content digest of the artifact, if known.
+	Digest string
+}
+
+// Lifecycle publishes the lifecycle events of the current build. Events
+// are best effort: a failure to publish one is logged and never fails
+// the build.
+type Lifecycle struct {
+	publisher *Publisher
+	start     time.Time
+}
+
+// NewLifecycle returns a Lifecycle timing the build from now.
+func NewLifecycle(ctx context.Context) (*Lifecycle, error) {
+	p, err := NewPublisher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Lifecycle{publisher: p, start: time.Now()}, nil
+}
+
+// BuildStarted publishes a build.started event for the apps being built.
+func (l *Lifecycle) BuildStarted(ctx context.Context, apps []string) {
+	b := currentBuild()
+	l.publish(ctx, buildStartedDetailType, buildstarted.Detail{
+		Build: buildstarted.Build(b),
+		Apps:  apps,
+	})
+}
+
+// ArtifactBuilt publishes an artifact.built event for an artifact which
+// took d to build.
+func (l *Lifecycle) ArtifactBuilt(ctx context.Context, a Artifact, d time.Duration) {
+	b := currentBuild()
+	l.publish(ctx, artifactBuiltDetailType, artifactbuilt.Detail{
+		Build:      artifactbuilt.Build(b),
+		Artifact:   artifactbuilt.Artifact(a.event()),
+		DurationMs: d.Milliseconds(),
+	})
+}
+
+// ArtifactPublished publishes an artifact.published event for an
+// artifact which took d to upload.
+func (l *Lifecycle) ArtifactPublished(ctx context.Context, a Artifact, d time.Duration) {
+	b := currentBuild()
+	l.publish(ctx, artifactPublishedDetailType, artifactpublished.Detail{
+		Build:      artifactpublished.Build(b),
+		Artifact:   artifactpublished.Artifact(a.event()),
+		DurationMs: d.Milliseconds(),
+	})
+}
+
+// BuildFinished publishes build.completed for the apps, or build.failed
+// if err is not nil.
+func (l *Lifecycle) BuildFinished(ctx context.Context, apps []string, err error) {
+	b := currentBuild()
+	d := time.Since(l.start).Milliseconds()
+	if err != nil {
+		l.publish(ctx, buildFailedDetailType, buildfailed.Detail{
+			Build:      buildfailed.Build(b),
+			Apps:       apps,
+			DurationMs: d,
+			Error:      err.Error(),
+		})
+		return
+	}
+	l.publish(ctx, buildCompletedDetailType, buildcompleted.Detail{
+		Build:      buildcompleted.Build(b),
+		Apps:       apps,
+		DurationMs: d,
+	})
+}
+
+// CatalogSynced publishes a catalog.synced event with the result of
+// syncing a catalog entity of the sync type.
+func (l *Lifecycle) CatalogSynced(ctx context.Context, entity, syncType string, err error) {
+	detail := catalogsynced.Detail{
+		Build:   catalogsynced.Build(currentBuild()),
+		Entity:  entity,
+		Type:    syncType,
+		Success: err == nil,
+	}
+	if err != nil {
+		detail.Error = strPtr(err.Error())
+	}
+	l.publish(ctx, catalogSyncedDetailType, detail)
+}
+
+func (l *Lifecycle) publish(ctx context.Context, detailType string, detail any) {
+	if err := l.publisher.Publish(ctx, detailType, detail); err != nil {
+		fmt.Println("failed to publish", detailType, "event:", err)
+	}
+}
+
+// build is the build reference shared by every lifecycle event. The
+// generated Build type of each schema package converts from it.
+type build struct {
+	Branch      string  `json:"branch"`
+	BuildNum    int64   `json:"buildNum"`
+	Repo        string  `json:"repo"`
+	Sha         string  `json:"sha"`
+	TriggeredBy *string `json:"triggeredBy,omitempty"`
+}
+
+func currentBuild() build {
+	b := build{
+		Branch:   environment.Branch(),
+		BuildNum: environment.CircleBuildNum(),
+		Repo:     environment.Repo(),
+		Sha:      environment.FullSHA1(),
+	}
+	if user := environment.CircleTriggeredBy(); user != "" {
+		b.TriggeredBy = strPtr(user)
+	}
+	return b
+}
+
+// artifact is the artifact reference shared by the artifact events.
+type artifact struct {
+	Digest    *string `json:"digest,omitempty"`
+	Name      string  `json:"name"`
+	Reference string  `json:"reference"`
+	Type      string  `json:"type"`
+}
+
+func (a Artifact) event() artifact {
+	e := artifact{Name: a.Name, Reference: a.Reference, Type: a.Type}
+	if a.Digest != "" {
+		e.Digest = strPtr(a.Digest)
+	}
+	return e
+}
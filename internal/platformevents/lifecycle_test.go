@@ -0,0 +1,74 @@
+package platformevents
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLifecycleBuildFinished(t *testing.T) {
+	t.Setenv("CIRCLE_BRANCH", "master")
+	t.Setenv("CIRCLE_BUILD_NUM", "42")
+	t.Setenv("CIRCLE_PROJECT_REPONAME", "my-test-repo")
+	t.Setenv("CIRCLE_SHA1", "abc1234def5678")
+	t.Setenv("CIRCLE_USERNAME", "octocat")
+
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	l := &Lifecycle{
+		publisher: &Publisher{sink: &FileSink{Path: path, Source: "circle-ci"}},
+		start:     time.Now(),
+	}
+	l.BuildFinished(context.Background(), []string{"app-a"}, errors.New("boom"))
+	l.BuildFinished(context.Background(), []string{"app-a"}, nil)
+
+	events := readEvents(t, path)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if events[0].DetailType != buildFailedDetailType || events[1].DetailType != buildCompletedDetailType {
+		t.Errorf("unexpected detail types %s, %s", events[0].DetailType, events[1].DetailType)
+	}
+	var failed struct {
+		Build struct{ BuildNum int64 }
+		Error string
+	}
+	if err := json.Unmarshal(events[0].Detail, &failed); err != nil {
+		t.Fatal(err)
+	}
+	if failed.Error != "boom" || failed.Build.BuildNum != 42 {
+		t.Errorf("unexpected build.failed detail %s", events[0].Detail)
+	}
+	var completed map[string]any
+	if err := json.Unmarshal(events[1].Detail, &completed); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := completed["error"]; ok {
+		t.Errorf("unexpected error in build.completed detail %s", events[1].Detail)
+	}
+}
+
+// readEvents reads the envelopes written by a FileSink.
+func readEvents(t *testing.T, path string) []envelope {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var out []envelope
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e envelope
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, e)
+	}
+	return out
+}
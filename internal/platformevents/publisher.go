@@ -0,0 +1,45 @@
+package platformevents
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Publisher publishes platform events to a sink. Every event is
+// validated against the schema of its detail type before it is sent.
+type Publisher struct {
+	sink Sink
+}
+
+// NewPublisher returns a publisher delivering to the sink configured by
+// the ci environment.
+func NewPublisher(ctx context.Context) (*Publisher, error) {
+	sink, err := NewSinkFromEnv(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Publisher{sink: sink}, nil
+}
+
+// Publish sends a single event with the detail, which must be the
+// generated Detail type of the detail type's schema package.
+func (p *Publisher) Publish(ctx context.Context, detailType string, detail any) error {
+	e, err := newEvent(detailType, detail)
+	if err != nil {
+		return err
+	}
+	return p.sink.Put(ctx, []Event{e})[0]
+}
+
+// newEvent marshals and validates the detail into an event.
+func newEvent(detailType string, detail any) (Event, error) {
+	bs, err := json.Marshal(detail)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to marshal %s event: %w", detailType, err)
+	}
+	if err := validateDetail(detailType, bs); err != nil {
+		return Event{}, err
+	}
+	return Event{DetailType: detailType, Detail: bs}, nil
+}
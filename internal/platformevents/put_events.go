@@ -0,0 +1,89 @@
+package platformevents
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+
+	"github.com/Clever/ci-scripts/internal/retry"
+)
+
+// maxPutEventsEntries is the most entries EventBridge accepts in a
+// single PutEvents call.
+const maxPutEventsEntries = 10
+
+// retryableErrorCodes are the entry error codes which EventBridge may
+// accept on a later attempt.
+var retryableErrorCodes = map[string]bool{
+	"ThrottlingException":    true,
+	"InternalFailure":        true,
+	"InternalException":      true,
+	"ServiceUnavailable":     true,
+	"LimitExceededException": true,
+}
+
+// putEventsAPI is the part of the EventBridge client used to publish
+// events.
+type putEventsAPI interface {
+	PutEvents(ctx context.Context, in *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error)
+}
+
+// putEntries publishes up to maxPutEventsEntries entries in one call.
+// EventBridge accepts or rejects each entry individually, so entries
+// rejected with a retryable error code are retried with backoff until
+// the policy's max elapsed time passes. The returned errors are
+// index-aligned with the entries.
+func putEntries(ctx context.Context, client putEventsAPI, policy retry.Policy, entries []types.PutEventsRequestEntry) []error {
+	errs := make([]error, len(entries))
+	pending := make([]int, len(entries))
+	for i := range entries {
+		pending[i] = i
+	}
+
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		batch := make([]types.PutEventsRequestEntry, len(pending))
+		for n, i := range pending {
+			batch[n] = entries[i]
+		}
+		out, err := client.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: batch})
+		if err != nil {
+			for _, i := range pending {
+				errs[i] = fmt.Errorf("failed to put event to EventBridge: %w", err)
+			}
+			return errs
+		}
+
+		var retryable []int
+		for n, i := range pending {
+			errs[i] = nil
+			if out.FailedEntryCount == 0 || n >= len(out.Entries) || out.Entries[n].ErrorCode == nil {
+				continue
+			}
+			code := aws.ToString(out.Entries[n].ErrorCode)
+			errs[i] = fmt.Errorf("EventBridge rejected event after %d attempts: %s: %s", attempt, code, aws.ToString(out.Entries[n].ErrorMessage))
+			if retryableErrorCodes[code] {
+				retryable = append(retryable, i)
+			}
+		}
+		if len(retryable) == 0 {
+			return errs
+		}
+
+		wait := policy.Backoff(attempt)
+		if time.Since(start)+wait > policy.MaxElapsedTime {
+			return errs
+		}
+		fmt.Printf("retrying %d rejected events in %s\n", len(retryable), wait.Round(time.Millisecond))
+		select {
+		case <-ctx.Done():
+			return errs
+		case <-time.After(wait):
+		}
+		pending = retryable
+	}
+}
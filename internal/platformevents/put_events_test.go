@@ -0,0 +1,81 @@
+package platformevents
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+
+	"github.com/Clever/ci-scripts/internal/retry"
+)
+
+// fakePutEvents rejects entries by detail with the scripted error codes,
+// one code per call. Once an entry's script is exhausted it is accepted.
+type fakePutEvents struct {
+	rejections map[string][]string
+	calls      [][]string
+}
+
+func (f *fakePutEvents) PutEvents(ctx context.Context, in *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	out := &eventbridge.PutEventsOutput{}
+	var call []string
+	for _, e := range in.Entries {
+		detail := aws.ToString(e.Detail)
+		call = append(call, detail)
+		res := types.PutEventsResultEntry{EventId: aws.String("id-" + detail)}
+		if codes := f.rejections[detail]; len(codes) > 0 {
+			f.rejections[detail] = codes[1:]
+			res = types.PutEventsResultEntry{ErrorCode: aws.String(codes[0]), ErrorMessage: aws.String("rejected")}
+			out.FailedEntryCount++
+		}
+		out.Entries = append(out.Entries, res)
+	}
+	f.calls = append(f.calls, call)
+	return out, nil
+}
+
+func TestPutEntriesRetriesFailedEntries(t *testing.T) {
+	client := &fakePutEvents{rejections: map[string][]string{
+		"b": {"ThrottlingException", "ThrottlingException"},
+		"c": {"ValidationException"},
+	}}
+	policy := retry.Policy{InitialInterval: time.Millisecond, MaxInterval: time.Millisecond, MaxElapsedTime: time.Second}
+
+	var entries []types.PutEventsRequestEntry
+	for _, d := range []string{"a", "b", "c"} {
+		entries = append(entries, types.PutEventsRequestEntry{Detail: aws.String(d)})
+	}
+	errs := putEntries(context.Background(), client, policy, entries)
+
+	if errs[0] != nil || errs[1] != nil {
+		t.Errorf("expected a and b to be published, got %v", errs)
+	}
+	if errs[2] == nil || !strings.Contains(errs[2].Error(), "ValidationException") {
+		t.Errorf("expected c to be rejected, got %v", errs[2])
+	}
+	want := [][]string{{"a", "b", "c"}, {"b"}, {"b"}}
+	if len(client.calls) != len(want) {
+		t.Fatalf("expected calls %v, got %v", want, client.calls)
+	}
+	for i := range want {
+		if strings.Join(client.calls[i], ",") != strings.Join(want[i], ",") {
+			t.Errorf("call %d: expected %v, got %v", i, want[i], client.calls[i])
+		}
+	}
+}
+
+func TestPutEntriesGivesUp(t *testing.T) {
+	client := &fakePutEvents{rejections: map[string][]string{
+		"a": {"ThrottlingException", "ThrottlingException", "ThrottlingException"},
+	}}
+	policy := retry.Policy{InitialInterval: 20 * time.Millisecond, MaxInterval: 20 * time.Millisecond, MaxElapsedTime: 0}
+
+	errs := putEntries(context.Background(), client, policy, []types.PutEventsRequestEntry{{Detail: aws.String("a")}})
+	if errs[0] == nil || !strings.Contains(errs[0].Error(), "ThrottlingException") {
+		t.Errorf("expected a to be throttled, got %v", errs[0])
+	}
+}
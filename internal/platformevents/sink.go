@@ -0,0 +1,284 @@
+package platformevents
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+
+	"github.com/Clever/ci-scripts/internal/environment"
+	"github.com/Clever/ci-scripts/internal/retry"
+)
+
+// Sink types which events may be delivered to.
+const (
+	// SinkEventBridge puts events on an EventBridge bus.
+	SinkEventBridge = "eventbridge"
+	// SinkFile appends events to a local JSONL file.
+	SinkFile = "file"
+	// SinkWebhook posts signed events to an HTTP endpoint.
+	SinkWebhook = "webhook"
+)
+
+// SignatureHeader holds the hex encoded HMAC-SHA256 of a webhook request
+// body, keyed with the webhook secret and prefixed with "sha256=".
+const SignatureHeader = "X-Goci-Signature-256"
+
+// Event is a validated platform event ready to be delivered.
+type Event struct {
+	DetailType string
+	Detail     json.RawMessage
+}
+
+// Sink delivers platform events.
+type Sink interface {
+	// Put delivers the events, returning an error for each event which
+	// was not delivered, index-aligned with the events.
+	Put(ctx context.Context, events []Event) []error
+}
+
+// SinkConfig configures where events are delivered. Only the fields of
+// the sink type are used.
+type SinkConfig struct {
+	// Type is one of SinkEventBridge, SinkFile or SinkWebhook.
+	Type string
+	// Source is the source of every event.
+	Source string
+	// Bus is the name of the EventBridge bus.
+	Bus string
+	// Path is the JSONL file events are appended to.
+	Path string
+	// URL and Secret are the webhook endpoint and the key requests are
+	// signed with.
+	URL    string
+	Secret string
+	// Retry is the retry policy of event deliveries.
+	Retry retry.Policy
+}
+
+// SinkConfigFromEnv builds the sink configuration from the ci
+// environment.
+func SinkConfigFromEnv() (SinkConfig, error) {
+	cfg := SinkConfig{
+		Type:   environment.PlatformEventsSink(),
+		Source: environment.PlatformEventsSource(),
+		Retry:  retry.NewPolicy(environment.RetryMaxElapsedTime()),
+	}
+	switch cfg.Type {
+	case SinkEventBridge:
+		cfg.Bus = environment.PlatformEventsBus()
+	case SinkFile:
+		cfg.Path = environment.PlatformEventsFile()
+	case SinkWebhook:
+		cfg.URL = environment.PlatformEventsWebhookURL()
+		cfg.Secret = environment.PlatformEventsWebhookSecret()
+	default:
+		return SinkConfig{}, fmt.Errorf("unknown platform events sink %q, expected %s, %s or %s", cfg.Type, SinkEventBridge, SinkFile, SinkWebhook)
+	}
+	return cfg, nil
+}
+
+// NewSink returns the sink described by the config.
+func NewSink(ctx context.Context, cfg SinkConfig) (Sink, error) {
+	switch cfg.Type {
+	case SinkEventBridge:
+		awsCfg := environment.AWSCfg(ctx, environment.OidcEventBridgeRole())
+		return &EventBridgeSink{
+			Bus:    cfg.Bus,
+			Source: cfg.Source,
+			client: eventbridge.NewFromConfig(awsCfg),
+			policy: cfg.Retry,
+		}, nil
+	case SinkFile:
+		return &FileSink{Path: cfg.Path, Source: cfg.Source}, nil
+	case SinkWebhook:
+		return &WebhookSink{
+			URL:    cfg.URL,
+			Secret: cfg.Secret,
+			Source: cfg.Source,
+			Client: &http.Client{
+				Transport: &retry.Transport{Policy: cfg.Retry},
+				Timeout:   cfg.Retry.Timeout(),
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown platform events sink %q", cfg.Type)
+	}
+}
+
+// NewSinkFromEnv returns the sink configured by the ci environment.
+func NewSinkFromEnv(ctx context.Context) (Sink, error) {
+	cfg, err := SinkConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return NewSink(ctx, cfg)
+}
+
+// EventBridgeSink puts events on an EventBridge bus.
+type EventBridgeSink struct {
+	Bus    string
+	Source string
+
+	client putEventsAPI
+	policy retry.Policy
+}
+
+// Put sends the events in batches of up to maxPutEventsEntries.
+func (s *EventBridgeSink) Put(ctx context.Context, events []Event) []error {
+	errs := make([]error, 0, len(events))
+	for start := 0; start < len(events); start += maxPutEventsEntries {
+		batch := events[start:min(start+maxPutEventsEntries, len(events))]
+		entries := make([]types.PutEventsRequestEntry, len(batch))
+		for i, e := range batch {
+			entries[i] = types.PutEventsRequestEntry{
+				EventBusName: strPtr(s.Bus),
+				DetailType:   strPtr(e.DetailType),
+				Source:       strPtr(s.Source),
+				Detail:       strPtr(string(e.Detail)),
+			}
+		}
+		errs = append(errs, putEntries(ctx, s.client, s.policy, entries)...)
+	}
+	return errs
+}
+
+// envelope is how events are written by the file and webhook sinks,
+// matching the fields of an EventBridge event.
+type envelope struct {
+	ID         string          `json:"id"`
+	Source     string          `json:"source"`
+	DetailType string          `json:"detail-type"`
+	Time       time.Time       `json:"time"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+func newEnvelope(source string, e Event) envelope {
+	return envelope{
+		// The ID is random, as the same event may legitimately be
+		// published twice, e.g. when a revision is redeployed. Only
+		// retries of a delivery reuse it.
+		ID:         newEventID(),
+		Source:     source,
+		DetailType: e.DetailType,
+		Time:       time.Now().UTC(),
+		Detail:     e.Detail,
+	}
+}
+
+// newEventID returns a random 128 bit hex ID.
+func newEventID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// FileSink appends each event to a JSONL file, one envelope per line,
+// for tests and dry runs. It is safe for concurrent use.
+type FileSink struct {
+	Path   string
+	Source string
+
+	mu sync.Mutex
+}
+
+func (s *FileSink) Put(ctx context.Context, events []Event) []error {
+	errs := make([]error, len(events))
+	var buf bytes.Buffer
+	for _, e := range events {
+		bs, err := json.Marshal(newEnvelope(s.Source, e))
+		if err != nil {
+			return fill(errs, fmt.Errorf("failed to marshal %s event: %w", e.DetailType, err))
+		}
+		buf.Write(bs)
+		buf.WriteByte('\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return fill(errs, fmt.Errorf("failed to create platform events directory: %w", err))
+	}
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fill(errs, fmt.Errorf("failed to open platform events file %s: %w", s.Path, err))
+	}
+	defer f.Close()
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return fill(errs, fmt.Errorf("failed to write platform events file %s: %w", s.Path, err))
+	}
+	return errs
+}
+
+// WebhookSink posts each event envelope as JSON to URL, signed in the
+// SignatureHeader so the receiver can verify it came from goci.
+type WebhookSink struct {
+	URL    string
+	Secret string
+	Source string
+	Client *http.Client
+}
+
+func (s *WebhookSink) Put(ctx context.Context, events []Event) []error {
+	errs := make([]error, len(events))
+	for i, e := range events {
+		errs[i] = s.post(ctx, newEnvelope(s.Source, e))
+	}
+	return errs
+}
+
+func (s *WebhookSink) post(ctx context.Context, env envelope) error {
+	body, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", env.DetailType, err)
+	}
+	req, err := http.NewRequestWithContext(retry.WithIdempotencyKey(ctx, env.ID), http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid platform events webhook url: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(s.Secret, body))
+
+	cli := s.Client
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post %s event: %w", env.DetailType, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("platform events webhook responded %s to %s event", resp.Status, env.DetailType)
+	}
+	return nil
+}
+
+// Sign returns the SignatureHeader value of a webhook request body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// fill sets every error to err.
+func fill(errs []error, err error) []error {
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
@@ -0,0 +1,83 @@
+package platformevents
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Clever/ci-scripts/internal/retry"
+)
+
+func TestWebhookSinkSignsEvents(t *testing.T) {
+	var (
+		got       envelope
+		signature string
+		body      []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+		json.Unmarshal(body, &got)
+	}))
+	defer srv.Close()
+
+	sink := &WebhookSink{URL: srv.URL, Secret: "s3cret", Source: "circle-ci-dev"}
+	errs := sink.Put(context.Background(), []Event{{DetailType: "build.started", Detail: json.RawMessage(`{"apps":["app-a"]}`)}})
+	if errs[0] != nil {
+		t.Fatal(errs[0])
+	}
+
+	if signature != Sign("s3cret", body) {
+		t.Errorf("signature %q does not match the body", signature)
+	}
+	if got.Source != "circle-ci-dev" || got.DetailType != "build.started" || string(got.Detail) != `{"apps":["app-a"]}` {
+		t.Errorf("unexpected event %+v", got)
+	}
+}
+
+func TestWebhookSinkRejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	sink := &WebhookSink{URL: srv.URL, Secret: "wrong"}
+	errs := sink.Put(context.Background(), []Event{{DetailType: "build.started", Detail: json.RawMessage(`{}`)}})
+	if errs[0] == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestWebhookSinkRedelivery(t *testing.T) {
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(retry.IdempotencyKeyHeader))
+		if len(keys) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	sink := &WebhookSink{URL: srv.URL, Secret: "s3cret", Client: &http.Client{Transport: &retry.Transport{Policy: retry.Policy{
+		InitialInterval: time.Millisecond,
+		MaxInterval:     time.Millisecond,
+		MaxElapsedTime:  time.Second,
+		AttemptTimeout:  time.Second,
+	}}}}
+	event := Event{DetailType: "deploy.created", Detail: json.RawMessage(`{"app":"app-a","targetRevision":"abc1234"}`)}
+	for range 2 {
+		if errs := sink.Put(context.Background(), []Event{event}); errs[0] != nil {
+			t.Fatal(errs[0])
+		}
+	}
+
+	// A retry is the same delivery, but publishing the same event again,
+	// as when a revision is redeployed, is a new one.
+	if len(keys) != 3 || keys[0] == "" || keys[0] != keys[1] || keys[1] == keys[2] {
+		t.Errorf("expected a retry with the same key followed by a new key, got %q", keys)
+	}
+}
@@ -0,0 +1,55 @@
+package platformevents
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/Clever/ci-scripts/internal/platformevents/schemas/artifactbuilt"
+	"github.com/Clever/ci-scripts/internal/platformevents/schemas/artifactpublished"
+	"github.com/Clever/ci-scripts/internal/platformevents/schemas/buildcompleted"
+	"github.com/Clever/ci-scripts/internal/platformevents/schemas/buildfailed"
+	"github.com/Clever/ci-scripts/internal/platformevents/schemas/buildstarted"
+	"github.com/Clever/ci-scripts/internal/platformevents/schemas/catalogsynced"
+	"github.com/Clever/ci-scripts/internal/platformevents/schemas/deploycreated"
+)
+
+// detailValidators are the generated schema validators of the detail of
+// every event type published, keyed by detail type.
+var detailValidators = map[string]func([]byte) error{
+	deployDetailType:            deploycreated.ValidateDetail,
+	buildStartedDetailType:      buildstarted.ValidateDetail,
+	artifactBuiltDetailType:     artifactbuilt.ValidateDetail,
+	artifactPublishedDetailType: artifactpublished.ValidateDetail,
+	buildCompletedDetailType:    buildcompleted.ValidateDetail,
+	buildFailedDetailType:       buildfailed.ValidateDetail,
+	catalogSyncedDetailType:     catalogsynced.ValidateDetail,
+}
+
+// validateDetail validates the marshaled detail of an event against the
+// schema of its detail type.
+func validateDetail(detailType string, detail []byte) error {
+	validate, ok := detailValidators[detailType]
+	if !ok {
+		return fmt.Errorf("no schema registered for %s events", detailType)
+	}
+	if err := validate(detail); err != nil {
+		return fmt.Errorf("invalid %s event: %s", detailType, describeSchemaError(err))
+	}
+	return nil
+}
+
+// describeSchemaError names the field which failed schema validation.
+func describeSchemaError(err error) string {
+	var schemaErr *openapi3.SchemaError
+	if !errors.As(err, &schemaErr) {
+		return err.Error()
+	}
+	field := strings.Join(schemaErr.JSONPointer(), ".")
+	if field == "" {
+		return schemaErr.Reason
+	}
+	return fmt.Sprintf("field %s: %s", field, schemaErr.Reason)
+}
@@ -0,0 +1,95 @@
+//go:build ignore
+
+// validate_gen writes a Validate function for each schema component of
+// an event schema in registry/, matching the validators schemabindings
+// generates for the events it fetches from the registry.
+//
+//	go run validate_gen.go -package buildstarted -o ./schemas/buildstarted/buildstarted.gen_validate.go ./registry/build.started.json
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/template"
+)
+
+var validateTmpl = template.Must(template.New("validate").Parse(`// Code generated by validate_gen.go from {{.Schema}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"encoding/json"
+	"fmt"
+)
+{{range .Components}}
+// Validate{{.}} unmarshals data as JSON and validates it against the {{.}}
+// schema component embedded in this package.
+func Validate{{.}}(data []byte) error {
+	swagger, err := GetSwagger()
+	if err != nil {
+		return fmt.Errorf("load embedded spec: %w", err)
+	}
+	ref, ok := swagger.Components.Schemas["{{.}}"]
+	if !ok || ref.Value == nil {
+		return fmt.Errorf("schema {{.}} not found in embedded spec")
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("unmarshal {{.}}: %w", err)
+	}
+	return ref.Value.VisitJSON(v)
+}
+{{end}}`))
+
+func main() {
+	pkg := flag.String("package", "", "name of the generated package")
+	out := flag.String("o", "", "file to write the validators to")
+	flag.Parse()
+	if *pkg == "" || *out == "" || flag.NArg() != 1 {
+		log.Fatal("usage: validate_gen -package <name> -o <file> <schema.json>")
+	}
+	schema := flag.Arg(0)
+
+	raw, err := os.ReadFile(schema)
+	if err != nil {
+		log.Fatalf("failed to read %s: %v", schema, err)
+	}
+	var spec struct {
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		log.Fatalf("failed to parse %s: %v", schema, err)
+	}
+	var components []string
+	for name := range spec.Components.Schemas {
+		components = append(components, name)
+	}
+	sort.Strings(components)
+
+	var buf bytes.Buffer
+	err = validateTmpl.Execute(&buf, map[string]any{
+		"Schema":     filepath.ToSlash(filepath.Clean(schema)),
+		"Package":    *pkg,
+		"Components": components,
+	})
+	if err != nil {
+		log.Fatalf("failed to generate validators: %v", err)
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("failed to format validators: %v", err)
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		log.Fatalf("failed to write %s: %v", *out, err)
+	}
+	fmt.Println("wrote", *out)
+}
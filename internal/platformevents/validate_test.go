@@ -0,0 +1,94 @@
+package platformevents
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Clever/ci-scripts/internal/deploy"
+	"github.com/Clever/ci-scripts/internal/repo"
+)
+
+// invalidFixtureErrors is the error expected from each invalid fixture in
+// testdata/<detail-type>.
+var invalidFixtureErrors = map[string]string{
+	"deploy.created/invalid-missing-app.json":           `property "app" is missing`,
+	"deploy.created/invalid-autoscaling-type.json":      "field overrides.autoscaling.min",
+	"build.started/invalid-missing-build.json":          `property "build" is missing`,
+	"artifact.built/invalid-duration-type.json":         "field durationMs",
+	"artifact.published/invalid-missing-reference.json": `property "reference" is missing`,
+	"build.completed/invalid-build-num-type.json":       "field build.buildNum",
+	"build.failed/invalid-missing-error.json":           `property "error" is missing`,
+	"catalog.synced/invalid-success-type.json":          "field success",
+}
+
+// TestDetailFixtures validates the fixtures of every event type
+// published. Fixtures named valid-* must pass and invalid-* must fail
+// with their expected error.
+func TestDetailFixtures(t *testing.T) {
+	for detailType := range detailValidators {
+		files, err := filepath.Glob(filepath.Join("testdata", detailType, "*.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		valid := 0
+		for _, file := range files {
+			name := filepath.Join(detailType, filepath.Base(file))
+			bs, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = validateDetail(detailType, bs)
+			switch {
+			case strings.HasPrefix(filepath.Base(file), "valid-"):
+				valid++
+				if err != nil {
+					t.Errorf("%s: unexpected error: %v", name, err)
+				}
+			case strings.HasPrefix(filepath.Base(file), "invalid-"):
+				want, ok := invalidFixtureErrors[name]
+				if !ok {
+					t.Errorf("%s: no expected error registered", name)
+				} else if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("%s: expected error containing %q, got %v", name, want, err)
+				}
+			default:
+				t.Errorf("%s: fixtures must be named valid-* or invalid-*", name)
+			}
+		}
+		if valid == 0 {
+			t.Errorf("%s: no valid fixtures in testdata", detailType)
+		}
+	}
+}
+
+func TestDeployDetailValid(t *testing.T) {
+	t.Setenv("CIRCLE_SHA1", "abc1234def5678")
+	t.Setenv("CIRCLE_PROJECT_REPONAME", "my-test-repo")
+	t.Setenv("CIRCLE_USERNAME", "octocat")
+
+	minInstances, maxInstances := 2, 10
+	event := deployDetail(deploy.Target{App: "my-test-app", Environment: "production", Revision: "abc1234"}, &repo.Commit{
+		SHA:         "abc1234def5678",
+		Author:      "octocat",
+		AuthorEmail: "1234+octocat@users.noreply.github.com",
+		Summary:     "Fix the thing",
+	})
+	event.Overrides = eventOverrides(&repo.DeployOverrides{
+		Env:         map[string]string{"LOG_LEVEL": "debug"},
+		Autoscaling: &repo.Autoscaling{Min: &minInstances, Max: &maxInstances},
+	})
+	detail, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateDetail(deployDetailType, detail); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(detail), `"app":"my-test-app"`) || !strings.Contains(string(detail), `"summary":"Fix the thing"`) {
+		t.Errorf("expected the detail and extensions in %s", detail)
+	}
+}
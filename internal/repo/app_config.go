@@ -3,6 +3,7 @@ package repo
 import (
 	"fmt"
 	"os"
+	"regexp"
 
 	"github.com/ghodss/yaml"
 )
@@ -12,11 +13,120 @@ const (
 )
 
 type appStackYAML struct {
-	AutoDeployEnvs []string `json:"autoDeployEnvs"`
+	AutoDeployEnvs []string        `json:"autoDeployEnvs"`
+	DeployRules    []DeployRule    `json:"deployRules,omitempty"`
+	Catapult       *CatapultDeploy `json:"catapult,omitempty"`
+	DeployAfter    []string        `json:"deployAfter,omitempty"`
+	// Overrides are keyed by environment.
+	Overrides map[string]DeployOverrides `json:"overrides,omitempty"`
 }
 
-// ReadAppStackAutoDeployEnvs reads autoDeployEnvs from config/<app>/stack.yaml.
-func AutoDeployEnvs(app string) ([]string, error) {
+// envVarNamePattern matches legal environment variable names.
+var envVarNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// DeployOverrides change how an app runs in a single environment.
+type DeployOverrides struct {
+	// Env sets environment variables, overriding the app's defaults.
+	Env map[string]string `json:"env,omitempty"`
+	// Autoscaling overrides the app's autoscaling bounds.
+	Autoscaling *Autoscaling `json:"autoscaling,omitempty"`
+}
+
+// Autoscaling bounds the number of instances of an app. Unset bounds are
+// left to the app's defaults.
+type Autoscaling struct {
+	Min *int `json:"min,omitempty"`
+	Max *int `json:"max,omitempty"`
+}
+
+func (o DeployOverrides) validate() error {
+	for name := range o.Env {
+		if !envVarNamePattern.MatchString(name) {
+			return fmt.Errorf("%q is not a valid environment variable name", name)
+		}
+	}
+	if a := o.Autoscaling; a != nil {
+		if a.Min != nil && *a.Min < 0 {
+			return fmt.Errorf("autoscaling min %d must not be negative", *a.Min)
+		}
+		if a.Max != nil && *a.Max < 1 {
+			return fmt.Errorf("autoscaling max %d must be at least 1", *a.Max)
+		}
+		if a.Min != nil && a.Max != nil && *a.Min > *a.Max {
+			return fmt.Errorf("autoscaling min %d is greater than max %d", *a.Min, *a.Max)
+		}
+	}
+	return nil
+}
+
+// CatapultDeploy configures how an app is deployed through catapult.
+// Empty fields are left for catapult to default.
+type CatapultDeploy struct {
+	// Environment is the environment to deploy to.
+	Environment string `json:"environment,omitempty"`
+	// Strategy is the deployment strategy, e.g. confirm-then-deploy or
+	// no-confirm-deploy.
+	Strategy string `json:"strategy,omitempty"`
+}
+
+// CatapultDeployConfig reads the catapult section from
+// config/<app>/stack.yaml. A missing file or section results in an
+// empty configuration.
+func CatapultDeployConfig(app string) (CatapultDeploy, error) {
+	stack, err := readAppStack(app)
+	if err != nil || stack == nil || stack.Catapult == nil {
+		return CatapultDeploy{}, err
+	}
+	return *stack.Catapult, nil
+}
+
+// DeployAfter reads deployAfter from config/<app>/stack.yaml for each of
+// the apps, returning the apps each must be deployed after. Every
+// prerequisite must be another application in this repo.
+func DeployAfter(apps []string) (map[string][]string, error) {
+	deps := map[string][]string{}
+	for _, app := range apps {
+		stack, err := readAppStack(app)
+		if err != nil {
+			return nil, err
+		}
+		if stack == nil || len(stack.DeployAfter) == 0 {
+			continue
+		}
+		for _, dep := range stack.DeployAfter {
+			if dep == app {
+				return nil, fmt.Errorf("%s cannot be deployed after itself", app)
+			}
+			if _, err := os.Stat(fmt.Sprintf(launchConfigPath, dep)); err != nil {
+				return nil, fmt.Errorf("%s is deployed after %s, which is not an application in this repo", app, dep)
+			}
+		}
+		deps[app] = stack.DeployAfter
+	}
+	return deps, nil
+}
+
+// DeployOverridesFor reads the overrides of the environment from
+// config/<app>/stack.yaml, returning nil if there are none. Invalid
+// overrides are an error.
+func DeployOverridesFor(app, env string) (*DeployOverrides, error) {
+	stack, err := readAppStack(app)
+	if err != nil || stack == nil {
+		return nil, err
+	}
+	o, ok := stack.Overrides[env]
+	if !ok {
+		return nil, nil
+	}
+	if err := o.validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s overrides for %s: %v", env, app, err)
+	}
+	return &o, nil
+}
+
+// readAppStack reads config/<app>/stack.yaml, returning nil if the app
+// has no stack config.
+func readAppStack(app string) (*appStackYAML, error) {
 	path := fmt.Sprintf(appStackConfigPath, app)
 	b, err := os.ReadFile(path)
 	if err != nil {
@@ -25,12 +135,11 @@ func AutoDeployEnvs(app string) ([]string, error) {
 		}
 		return nil, err
 	}
+	// Unknown fields are most likely typos, which would otherwise be
+	// silently ignored.
 	var stack appStackYAML
-	if err := yaml.Unmarshal(b, &stack); err != nil {
+	if err := yaml.UnmarshalStrict(b, &stack, yaml.DisallowUnknownFields); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal stack.yaml for %s: %w", path, err)
 	}
-	if len(stack.AutoDeployEnvs) == 0 {
-		return nil, nil
-	}
-	return stack.AutoDeployEnvs, nil
+	return &stack, nil
 }
@@ -0,0 +1,49 @@
+package repo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDeployOverridesValidate(t *testing.T) {
+	intPtr := func(i int) *int { return &i }
+	for _, tc := range []struct {
+		name    string
+		o       DeployOverrides
+		wantErr string
+	}{
+		{
+			name: "valid",
+			o: DeployOverrides{
+				Env:         map[string]string{"LOG_LEVEL": "debug", "_PRIVATE2": "x"},
+				Autoscaling: &Autoscaling{Min: intPtr(2), Max: intPtr(10)},
+			},
+		},
+		{
+			name:    "bad env var name",
+			o:       DeployOverrides{Env: map[string]string{"2FAST": "x"}},
+			wantErr: `"2FAST" is not a valid environment variable name`,
+		},
+		{
+			name:    "min greater than max",
+			o:       DeployOverrides{Autoscaling: &Autoscaling{Min: intPtr(5), Max: intPtr(3)}},
+			wantErr: "autoscaling min 5 is greater than max 3",
+		},
+		{
+			name:    "zero max",
+			o:       DeployOverrides{Autoscaling: &Autoscaling{Max: intPtr(0)}},
+			wantErr: "autoscaling max 0 must be at least 1",
+		},
+	} {
+		err := tc.o.validate()
+		if tc.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tc.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: expected error %q, got %v", tc.name, tc.wantErr, err)
+		}
+	}
+}
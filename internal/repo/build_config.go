@@ -0,0 +1,136 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	launchConfigPath = "launch/%s.yml"
+)
+
+// ExtendedBuild holds goci specific build configuration which is not
+// part of the catapult launch config model. It is read from the same
+// build section of the application's launch yaml.
+type ExtendedBuild struct {
+	Lambda *LambdaBuild `json:"lambda,omitempty"`
+	Static *StaticBuild `json:"static,omitempty"`
+}
+
+// LambdaBuild configures where a lambda artifact is published. Any
+// unset fields fall back to the repo wide environment configuration.
+type LambdaBuild struct {
+	// Regions is the list of regions to upload the lambda artifact to.
+	Regions []string `json:"regions,omitempty"`
+	// BucketTemplate is the naming template of the regional buckets.
+	// The placeholders {prefix} and {region} are replaced with the
+	// lambda bucket prefix and region.
+	BucketTemplate string `json:"bucketTemplate,omitempty"`
+	// Layers are lambda layers built and published alongside the
+	// application.
+	Layers []LambdaLayer `json:"layers,omitempty"`
+}
+
+// LambdaLayer configures a lambda layer archive which is uploaded to
+// the same regional buckets as the application's lambda artifact.
+type LambdaLayer struct {
+	// Name is the name of the layer.
+	Name string `json:"name"`
+	// Command is the command to run to build the layer archive.
+	Command string `json:"command,omitempty"`
+	// Zip is the path to the built layer archive. It defaults to
+	// ./bin/<name>.zip.
+	Zip string `json:"zip,omitempty"`
+	// Publish publishes a new layer version in each region after the
+	// archive is uploaded.
+	Publish bool `json:"publish,omitempty"`
+	// CompatibleRuntimes and CompatibleArchitectures are passed through
+	// to the published layer version.
+	CompatibleRuntimes      []string `json:"compatibleRuntimes,omitempty"`
+	CompatibleArchitectures []string `json:"compatibleArchitectures,omitempty"`
+}
+
+// StaticBuild configures a bundle of static files, such as a frontend
+// build or docs, which is uploaded to S3.
+type StaticBuild struct {
+	// Source is the local directory holding the built files.
+	Source string `json:"source"`
+	// Bucket and Prefix are the destination of the files. Both are
+	// templates where {app}, {repo}, {branch}, {sha} and {fullsha} are
+	// replaced with values from the build.
+	Bucket string `json:"bucket"`
+	Prefix string `json:"prefix,omitempty"`
+	// Region is the region of the bucket. It defaults to us-west-2.
+	Region string `json:"region,omitempty"`
+	// Encodings maps a content encoding (gzip or br) to the file
+	// extensions which are compressed with it.
+	Encodings map[string][]string `json:"encodings,omitempty"`
+	// ContentTypes overrides the detected content type by file
+	// extension.
+	ContentTypes map[string]string `json:"contentTypes,omitempty"`
+	// CacheControl is an ordered list of rules. The first rule with a
+	// pattern matching a file sets its Cache-Control header.
+	CacheControl []CacheControlRule `json:"cacheControl,omitempty"`
+	// DeleteStale removes any objects under the prefix which are not
+	// part of the uploaded bundle.
+	DeleteStale bool `json:"deleteStale,omitempty"`
+	// Workers is the number of files uploaded in parallel.
+	Workers int `json:"workers,omitempty"`
+}
+
+// CacheControlRule sets the Cache-Control header of files matching
+// Pattern. Patterns containing a / are matched against the path relative
+// to the source directory, all others against the file name.
+type CacheControlRule struct {
+	Pattern string `json:"pattern"`
+	Value   string `json:"value"`
+}
+
+type launchBuildYAML struct {
+	Build *ExtendedBuild `json:"build,omitempty"`
+	Team  string         `json:"team,omitempty"`
+}
+
+// ExtendedBuildConfig reads the goci specific build configuration from
+// launch/<app>.yml. A missing launch config or build section results in
+// an empty configuration.
+func ExtendedBuildConfig(app string) (*ExtendedBuild, error) {
+	launch, err := readLaunchBuild(app)
+	if err != nil {
+		return nil, err
+	}
+	if launch.Build == nil {
+		return &ExtendedBuild{}, nil
+	}
+	return launch.Build, nil
+}
+
+// readLaunchBuild reads the goci specific fields of launch/<app>.yml. A
+// missing launch config results in an empty configuration.
+func readLaunchBuild(app string) (*launchBuildYAML, error) {
+	path := fmt.Sprintf(launchConfigPath, app)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &launchBuildYAML{}, nil
+		}
+		return nil, err
+	}
+	var launch launchBuildYAML
+	if err := yaml.Unmarshal(b, &launch); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal build config for %s: %w", path, err)
+	}
+	return &launch, nil
+}
+
+// Team reads the team which owns the application from launch/<app>.yml.
+// An empty string is returned if no team is set.
+func Team(app string) (string, error) {
+	launch, err := readLaunchBuild(app)
+	if err != nil {
+		return "", err
+	}
+	return launch.Team, nil
+}
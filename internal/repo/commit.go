@@ -0,0 +1,51 @@
+package repo
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// commitFormat is the git log format of a Commit, with fields separated
+// by NUL bytes since none may contain one.
+const commitFormat = "%H%x00%an%x00%ae%x00%s"
+
+// Commit is the author and summary of a git commit.
+type Commit struct {
+	SHA         string
+	Author      string
+	AuthorEmail string
+	// Summary is the first line of the commit message.
+	Summary string
+}
+
+// ReadCommit reads the commit at the revision, which may be a full or
+// short SHA, with git log.
+func ReadCommit(revision string) (*Commit, error) {
+	output, err := exec.Command("git", "log", "-1", "--format="+commitFormat, revision, "--").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log %s: %v", revision, err)
+	}
+	return parseCommit(string(output))
+}
+
+func parseCommit(output string) (*Commit, error) {
+	fields := strings.Split(strings.TrimRight(output, "\n"), "\x00")
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("unexpected git log output %q", output)
+	}
+	return &Commit{SHA: fields[0], Author: fields[1], AuthorEmail: fields[2], Summary: fields[3]}, nil
+}
+
+// GithubLogin returns the GitHub username in the author email, if it is
+// a GitHub noreply address such as 1234+octocat@users.noreply.github.com.
+func (c *Commit) GithubLogin() string {
+	local, domain, ok := strings.Cut(c.AuthorEmail, "@")
+	if !ok || !strings.EqualFold(domain, "users.noreply.github.com") {
+		return ""
+	}
+	if _, login, ok := strings.Cut(local, "+"); ok {
+		return login
+	}
+	return local
+}
@@ -0,0 +1,30 @@
+package repo
+
+import "testing"
+
+func TestParseCommit(t *testing.T) {
+	c, err := parseCommit("abc1234def5678\x00The Octocat\x001234+octocat@users.noreply.github.com\x00Fix the thing\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Commit{SHA: "abc1234def5678", Author: "The Octocat", AuthorEmail: "1234+octocat@users.noreply.github.com", Summary: "Fix the thing"}
+	if *c != want {
+		t.Errorf("expected %+v, got %+v", want, *c)
+	}
+	if _, err := parseCommit("not a commit\n"); err == nil {
+		t.Error("expected an error for malformed output")
+	}
+}
+
+func TestCommitGithubLogin(t *testing.T) {
+	for email, want := range map[string]string{
+		"1234+octocat@users.noreply.github.com": "octocat",
+		"OctoCat@Users.NoReply.GitHub.com":      "OctoCat",
+		"octocat@example.com":                   "",
+		"":                                      "",
+	} {
+		if got := (&Commit{AuthorEmail: email}).GithubLogin(); got != want {
+			t.Errorf("%q: expected %q, got %q", email, want, got)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	// Schedules name IANA time zones, which CI images may not have
+	// installed.
+	_ "time/tzdata"
+
+	"github.com/ghodss/yaml"
+)
+
+// deployConfigPath is the repo-wide deploy configuration.
+const deployConfigPath = "config/deploy.yaml"
+
+// DeployRule deploys an app to environments when the branch being built
+// matches Branch, a glob in which * matches within a path segment.
+type DeployRule struct {
+	Branch       string   `json:"branch"`
+	Environments []string `json:"environments"`
+	// Schedule, if set, limits when the rule deploys.
+	Schedule *DeploySchedule `json:"schedule,omitempty"`
+}
+
+// DeploySchedule is a weekly window in which deploys are allowed.
+type DeploySchedule struct {
+	// Days are the three letter days of the week, e.g. mon. Every day is
+	// allowed if empty.
+	Days []string `json:"days,omitempty"`
+	// Hours is the time of day deploys are allowed, as a start and an
+	// exclusive end such as 9-16 or 09:30-16:00. The whole day is allowed
+	// if empty.
+	Hours string `json:"hours,omitempty"`
+	// Timezone is the IANA time zone of Hours and Days. It defaults to
+	// UTC.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// FreezeWindow stops every deploy to its environments, or to every
+// environment if it lists none, from Start until End.
+type FreezeWindow struct {
+	Name         string    `json:"name"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	Environments []string  `json:"environments,omitempty"`
+}
+
+// ApprovalConfig lists the environments whose deploys must be approved
+// before they are published.
+type ApprovalConfig struct {
+	Environments []string `json:"environments"`
+	// Timeout is how long to wait for approval, as a go duration. It
+	// defaults to defaultApprovalTimeout.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+// defaultApprovalTimeout is how long deploys wait for approval if the
+// config does not say.
+const defaultApprovalTimeout = time.Hour
+
+type deployConfigYAML struct {
+	Freezes   []FreezeWindow  `json:"freezes,omitempty"`
+	Approvals *ApprovalConfig `json:"approvals,omitempty"`
+}
+
+// DeployDecision is whether an app is deployed to an environment, and
+// why.
+type DeployDecision struct {
+	Environment string
+	Deploy      bool
+	Reason      string
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// DeployRules reads the deployRules of config/<app>/stack.yaml. A legacy
+// autoDeployEnvs list is a rule deploying to its environments from each
+// of the legacyBranches.
+func DeployRules(app string, legacyBranches []string) ([]DeployRule, error) {
+	stack, err := readAppStack(app)
+	if err != nil || stack == nil {
+		return nil, err
+	}
+	for i, r := range stack.DeployRules {
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("invalid deploy rule %d for %s: %v", i+1, app, err)
+		}
+	}
+	rules := stack.DeployRules
+	if len(stack.AutoDeployEnvs) > 0 {
+		for _, branch := range legacyBranches {
+			rules = append(rules, DeployRule{Branch: branch, Environments: stack.AutoDeployEnvs})
+		}
+	}
+	return rules, nil
+}
+
+// DeployFreezes reads the freeze windows of config/deploy.yaml. A
+// missing file has none.
+func DeployFreezes() ([]FreezeWindow, error) {
+	cfg, err := readDeployConfig()
+	if err != nil {
+		return nil, err
+	}
+	for i, f := range cfg.Freezes {
+		if f.Start.IsZero() || f.End.IsZero() {
+			return nil, fmt.Errorf("freeze window %d in %s must have a start and an end", i+1, deployConfigPath)
+		}
+		if !f.End.After(f.Start) {
+			return nil, fmt.Errorf("freeze window %d in %s ends before it starts", i+1, deployConfigPath)
+		}
+	}
+	return cfg.Freezes, nil
+}
+
+// DeployApprovals reads the approvals of config/deploy.yaml, returning
+// nil if no environment is gated.
+func DeployApprovals() (*ApprovalConfig, error) {
+	cfg, err := readDeployConfig()
+	if err != nil || cfg.Approvals == nil || len(cfg.Approvals.Environments) == 0 {
+		return nil, err
+	}
+	if _, err := cfg.Approvals.TimeoutDuration(); err != nil {
+		return nil, err
+	}
+	return cfg.Approvals, nil
+}
+
+// TimeoutDuration parses the approval timeout.
+func (a *ApprovalConfig) TimeoutDuration() (time.Duration, error) {
+	if a.Timeout == "" {
+		return defaultApprovalTimeout, nil
+	}
+	d, err := time.ParseDuration(a.Timeout)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("approval timeout %q in %s must be a positive duration such as 30m", a.Timeout, deployConfigPath)
+	}
+	return d, nil
+}
+
+// readDeployConfig reads config/deploy.yaml. A missing file is empty.
+func readDeployConfig() (*deployConfigYAML, error) {
+	cfg := &deployConfigYAML{}
+	b, err := os.ReadFile(deployConfigPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(b, cfg, yaml.DisallowUnknownFields); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", deployConfigPath, err)
+	}
+	return cfg, nil
+}
+
+// EvaluateDeployRules decides which environments an app is deployed to
+// from the branch at time now. An environment is deployed if any rule
+// matching the branch lists it and allows deploys now, unless it is
+// frozen. If envOverride is set, only the rules naming it apply, or if
+// none do it replaces the environments of every rule. The schedules of
+// the rules still apply, and a rule must still match the branch. Every
+// environment named by a rule, or the override, has a decision in the
+// order first named.
+func EvaluateDeployRules(rules []DeployRule, freezes []FreezeWindow, branch, envOverride string, now time.Time) []DeployDecision {
+	var (
+		decisions []DeployDecision
+		// levels holds how close each environment came to being
+		// deployed, so that the most relevant reason is reported.
+		levels []int
+		index  = map[string]int{}
+	)
+	const (
+		branchMismatch = iota
+		outsideSchedule
+		deploy
+	)
+	decide := func(env string, level int, reason string) {
+		i, ok := index[env]
+		if !ok {
+			index[env] = len(decisions)
+			decisions = append(decisions, DeployDecision{Environment: env})
+			levels = append(levels, -1)
+			i = len(decisions) - 1
+		}
+		if level > levels[i] {
+			levels[i] = level
+			decisions[i] = DeployDecision{Environment: env, Deploy: level == deploy, Reason: reason}
+		}
+	}
+
+	named := false
+	for _, r := range rules {
+		named = named || slices.Contains(r.Environments, envOverride)
+	}
+	for _, r := range rules {
+		envs := r.Environments
+		if envOverride != "" {
+			if named && !slices.Contains(r.Environments, envOverride) {
+				continue
+			}
+			envs = []string{envOverride}
+		}
+		for _, env := range envs {
+			switch {
+			case !r.matches(branch):
+				decide(env, branchMismatch, fmt.Sprintf("branch %s does not match %s", branch, r.Branch))
+			case r.Schedule != nil && !r.Schedule.allows(now):
+				decide(env, outsideSchedule, fmt.Sprintf("outside the %s schedule of %s", r.Schedule, r.Branch))
+			default:
+				decide(env, deploy, fmt.Sprintf("branch %s matches %s", branch, r.Branch))
+			}
+		}
+	}
+	if envOverride != "" && len(decisions) == 0 {
+		decide(envOverride, branchMismatch, "no deploy rules are configured")
+	}
+
+	for i, d := range decisions {
+		if !d.Deploy {
+			continue
+		}
+		if f := Frozen(freezes, d.Environment, now); f != nil {
+			decisions[i].Deploy = false
+			decisions[i].Reason = fmt.Sprintf("deploys are frozen for %s until %s", f.Name, f.End.Format(time.RFC3339))
+		}
+	}
+	return decisions
+}
+
+// Frozen returns the first freeze window covering the environment at
+// time now, or nil if deploys to it are allowed.
+func Frozen(freezes []FreezeWindow, env string, now time.Time) *FreezeWindow {
+	for i, f := range freezes {
+		if now.Before(f.Start) || !now.Before(f.End) {
+			continue
+		}
+		if len(f.Environments) == 0 {
+			return &freezes[i]
+		}
+		for _, e := range f.Environments {
+			if e == env {
+				return &freezes[i]
+			}
+		}
+	}
+	return nil
+}
+
+func (r DeployRule) matches(branch string) bool {
+	ok, _ := path.Match(r.Branch, branch)
+	return ok
+}
+
+func (r DeployRule) validate() error {
+	if r.Branch == "" {
+		return fmt.Errorf("branch is required")
+	}
+	if _, err := path.Match(r.Branch, ""); err != nil {
+		return fmt.Errorf("branch %q is not a valid glob", r.Branch)
+	}
+	if len(r.Environments) == 0 {
+		return fmt.Errorf("environments is required")
+	}
+	if r.Schedule != nil {
+		return r.Schedule.validate()
+	}
+	return nil
+}
+
+func (s *DeploySchedule) validate() error {
+	for _, d := range s.Days {
+		if _, ok := weekdays[strings.ToLower(d)]; !ok {
+			return fmt.Errorf("unknown schedule day %q, expected one of mon, tue, wed, thu, fri, sat or sun", d)
+		}
+	}
+	if _, _, err := s.hours(); err != nil {
+		return err
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("unknown schedule timezone %q", s.Timezone)
+	}
+	return nil
+}
+
+// allows returns true if now falls within the schedule.
+func (s *DeploySchedule) allows(now time.Time) bool {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return false
+	}
+	now = now.In(loc)
+
+	if len(s.Days) > 0 {
+		allowed := false
+		for _, d := range s.Days {
+			if weekdays[strings.ToLower(d)] == now.Weekday() {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+
+	start, end, err := s.hours()
+	if err != nil {
+		return false
+	}
+	minute := now.Hour()*60 + now.Minute()
+	return minute >= start && minute < end
+}
+
+// hours returns the minutes of the day the schedule starts and ends.
+func (s *DeploySchedule) hours() (int, int, error) {
+	if s.Hours == "" {
+		return 0, 24 * 60, nil
+	}
+	from, to, ok := strings.Cut(s.Hours, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("schedule hours %q must be a range such as 9-16", s.Hours)
+	}
+	start, err := minuteOfDay(from)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid schedule hours %q: %v", s.Hours, err)
+	}
+	end, err := minuteOfDay(to)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid schedule hours %q: %v", s.Hours, err)
+	}
+	if end <= start {
+		return 0, 0, fmt.Errorf("schedule hours %q must end after they start", s.Hours)
+	}
+	return start, end, nil
+}
+
+func (s *DeploySchedule) String() string {
+	days := "every day"
+	if len(s.Days) > 0 {
+		days = strings.Join(s.Days, ",")
+	}
+	hours := s.Hours
+	if hours == "" {
+		hours = "all day"
+	}
+	tz := s.Timezone
+	if tz == "" {
+		tz = "UTC"
+	}
+	return fmt.Sprintf("%s %s %s", days, hours, tz)
+}
+
+// minuteOfDay parses an hour, or an hour and minutes such as 09:30, into
+// minutes since midnight. 24 is the end of the day.
+func minuteOfDay(s string) (int, error) {
+	h, m, hasMinutes := strings.Cut(strings.TrimSpace(s), ":")
+	hour, err := strconv.Atoi(h)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time of day", s)
+	}
+	minute := 0
+	if hasMinutes {
+		if minute, err = strconv.Atoi(m); err != nil || minute < 0 || minute > 59 {
+			return 0, fmt.Errorf("%q is not a time of day", s)
+		}
+	}
+	if hour < 0 || hour > 24 || (hour == 24 && minute > 0) {
+		return 0, fmt.Errorf("%q is not a time of day", s)
+	}
+	return hour*60 + minute, nil
+}
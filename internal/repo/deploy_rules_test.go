@@ -0,0 +1,189 @@
+package repo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghodss/yaml"
+)
+
+func TestEvaluateDeployRules(t *testing.T) {
+	pt, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		// Wednesday 2026-10-14.
+		weekdayMorning = time.Date(2026, 10, 14, 10, 0, 0, 0, pt)
+		weekdayEvening = time.Date(2026, 10, 14, 16, 0, 0, 0, pt)
+		saturday       = time.Date(2026, 10, 17, 10, 0, 0, 0, pt)
+	)
+	rules := []DeployRule{
+		{Branch: "master", Environments: []string{"clever-dev"}},
+		{Branch: "master", Environments: []string{"production"}, Schedule: &DeploySchedule{
+			Days:     []string{"mon", "tue", "wed", "thu", "fri"},
+			Hours:    "9-16",
+			Timezone: "America/Los_Angeles",
+		}},
+		{Branch: "release/*", Environments: []string{"staging"}},
+	}
+	freezes := []FreezeWindow{{
+		Name:         "winter break",
+		Start:        time.Date(2026, 12, 20, 0, 0, 0, 0, pt),
+		End:          time.Date(2027, 1, 4, 0, 0, 0, 0, pt),
+		Environments: []string{"production"},
+	}}
+
+	for _, tc := range []struct {
+		name        string
+		branch      string
+		envOverride string
+		now         time.Time
+		want        map[string]string
+	}{
+		{
+			name:   "master on a weekday",
+			branch: "master",
+			now:    weekdayMorning,
+			want: map[string]string{
+				"clever-dev": "",
+				"production": "",
+				"staging":    "branch master does not match release/*",
+			},
+		},
+		{
+			name:   "master after hours",
+			branch: "master",
+			now:    weekdayEvening,
+			want: map[string]string{
+				"clever-dev": "",
+				"production": "outside the mon,tue,wed,thu,fri 9-16 America/Los_Angeles schedule of master",
+				"staging":    "branch master does not match release/*",
+			},
+		},
+		{
+			name:   "master on a weekend",
+			branch: "master",
+			now:    saturday,
+			want: map[string]string{
+				"clever-dev": "",
+				"production": "outside the mon,tue,wed,thu,fri 9-16 America/Los_Angeles schedule of master",
+				"staging":    "branch master does not match release/*",
+			},
+		},
+		{
+			name:   "release branch",
+			branch: "release/2026-10",
+			now:    weekdayMorning,
+			want: map[string]string{
+				"clever-dev": "branch release/2026-10 does not match master",
+				"production": "branch release/2026-10 does not match master",
+				"staging":    "",
+			},
+		},
+		{
+			name:   "production freeze",
+			branch: "master",
+			now:    time.Date(2026, 12, 22, 10, 0, 0, 0, pt),
+			want: map[string]string{
+				"clever-dev": "",
+				"production": "deploys are frozen for winter break until 2027-01-04T00:00:00-08:00",
+				"staging":    "branch master does not match release/*",
+			},
+		},
+		{
+			name:        "env override keeps the schedule of its rules",
+			branch:      "master",
+			envOverride: "production",
+			now:         saturday,
+			want: map[string]string{
+				"production": "outside the mon,tue,wed,thu,fri 9-16 America/Los_Angeles schedule of master",
+			},
+		},
+		{
+			name:        "env override in schedule",
+			branch:      "master",
+			envOverride: "production",
+			now:         weekdayMorning,
+			want:        map[string]string{"production": ""},
+		},
+		{
+			name:        "env override of an environment no rule names",
+			branch:      "master",
+			envOverride: "clever-demo",
+			now:         saturday,
+			want:        map[string]string{"clever-demo": ""},
+		},
+		{
+			name:        "env override on an unmatched branch",
+			branch:      "feature",
+			envOverride: "clever-demo",
+			now:         weekdayMorning,
+			want:        map[string]string{"clever-demo": "branch feature does not match master"},
+		},
+	} {
+		got := map[string]string{}
+		for _, d := range EvaluateDeployRules(rules, freezes, tc.branch, tc.envOverride, tc.now) {
+			if d.Deploy {
+				got[d.Environment] = ""
+			} else {
+				got[d.Environment] = d.Reason
+			}
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestDeployRuleValidate(t *testing.T) {
+	for _, tc := range []struct {
+		rule    DeployRule
+		wantErr string
+	}{
+		{rule: DeployRule{Branch: "release/*", Environments: []string{"staging"}}},
+		{rule: DeployRule{Branch: "[", Environments: []string{"staging"}}, wantErr: "not a valid glob"},
+		{rule: DeployRule{Branch: "master"}, wantErr: "environments is required"},
+		{
+			rule:    DeployRule{Branch: "master", Environments: []string{"production"}, Schedule: &DeploySchedule{Days: []string{"weekdays"}}},
+			wantErr: `unknown schedule day "weekdays"`,
+		},
+		{
+			rule:    DeployRule{Branch: "master", Environments: []string{"production"}, Schedule: &DeploySchedule{Hours: "16-9"}},
+			wantErr: "must end after they start",
+		},
+		{
+			rule:    DeployRule{Branch: "master", Environments: []string{"production"}, Schedule: &DeploySchedule{Timezone: "PT"}},
+			wantErr: `unknown schedule timezone "PT"`,
+		},
+	} {
+		err := tc.rule.validate()
+		if tc.wantErr == "" {
+			if err != nil {
+				t.Errorf("%+v: unexpected error: %v", tc.rule, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%+v: expected error %q, got %v", tc.rule, tc.wantErr, err)
+		}
+	}
+}
+
+func TestFreezeWindowYAML(t *testing.T) {
+	var cfg deployConfigYAML
+	err := yaml.Unmarshal([]byte(`
+freezes:
+  - name: winter break
+    start: 2026-12-20T00:00:00-08:00
+    end: 2027-01-04T00:00:00-08:00
+`), &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Freezes) != 1 || cfg.Freezes[0].End.Year() != 2027 {
+		t.Errorf("unexpected freezes %+v", cfg.Freezes)
+	}
+}
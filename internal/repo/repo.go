@@ -20,6 +20,16 @@ import (
 // according to the launch config dependencies are filtered from the
 // result set.
 func DiscoverApplications(dir string) (map[string]*models.LaunchConfig, error) {
+	return discoverApplications(dir, true)
+}
+
+// DiscoverAllApplications is DiscoverApplications without filtering
+// applications which have no changes.
+func DiscoverAllApplications(dir string) (map[string]*models.LaunchConfig, error) {
+	return discoverApplications(dir, false)
+}
+
+func discoverApplications(dir string, changedOnly bool) (map[string]*models.LaunchConfig, error) {
 	fe, err := os.ReadDir(dir)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -52,6 +62,10 @@ func DiscoverApplications(dir string) (map[string]*models.LaunchConfig, error) {
 			continue
 		}
 
+		if !changedOnly {
+			m[strings.TrimSuffix(f.Name(), ".yml")] = &lc
+			continue
+		}
 		if changed, err := DetectArtifactDependencyChange(&lc); err != nil {
 			return nil, fmt.Errorf("failed to detect artifact dependency change for %s: %v", f.Name(), err)
 		} else if !changed {
@@ -106,6 +120,18 @@ func IsLambdaRunType(lc *models.LaunchConfig) bool {
 	return false
 }
 
+// RunTypeSpark is the run type of spark jobs run on AWS Glue.
+const RunTypeSpark models.RunType = "spark"
+
+// IsSparkRunType returns true if the launch config specifies a run type
+// of spark.
+func IsSparkRunType(lc *models.LaunchConfig) bool {
+	if r := lc.Run; r != nil {
+		return r.Type == RunTypeSpark
+	}
+	return false
+}
+
 // ArtifactName returns the correct artifact name for the application.
 // The default pattern is the app name. There is an optional launch
 // config override in order to enable sharing one artifact between
@@ -0,0 +1,123 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// StackLint holds the problems found in the stack configs of a repo.
+// Errors make the config unusable, while warnings may be intentional.
+type StackLint struct {
+	Errors   []string
+	Warnings []string
+}
+
+func (l *StackLint) errorf(format string, args ...any) {
+	l.Errors = append(l.Errors, fmt.Sprintf(format, args...))
+}
+
+// LintStacks checks every config/<app>/stack.yaml against the launch
+// configs in launch/ and the known environments. A stack config must be
+// valid YAML with only known fields, belong to an app with a launch
+// config, and only name known environments. Launch configs without a
+// stack config are warnings, as the app is simply never auto deployed.
+func LintStacks(knownEnvs []string) (*StackLint, error) {
+	lint := &StackLint{}
+	launchApps, err := appNames(fmt.Sprintf(launchConfigPath, "*"))
+	if err != nil {
+		return nil, err
+	}
+	stackApps, err := appNames(fmt.Sprintf(appStackConfigPath, "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[string]bool{}
+	for _, env := range knownEnvs {
+		known[env] = true
+	}
+	for _, app := range sortedKeys(stackApps) {
+		path := fmt.Sprintf(appStackConfigPath, app)
+		if !launchApps[app] {
+			lint.errorf("%s: no launch config %s for app %s", path, fmt.Sprintf(launchConfigPath, app), app)
+		}
+		stack, err := readAppStack(app)
+		if err != nil {
+			lint.Errors = append(lint.Errors, err.Error())
+			continue
+		}
+		lintStack(lint, path, app, stack, known, launchApps)
+	}
+	for _, app := range sortedKeys(launchApps) {
+		if !stackApps[app] {
+			lint.Warnings = append(lint.Warnings, fmt.Sprintf("%s: app %s has no stack config %s", fmt.Sprintf(launchConfigPath, app), app, fmt.Sprintf(appStackConfigPath, app)))
+		}
+	}
+	return lint, nil
+}
+
+func lintStack(lint *StackLint, path, app string, stack *appStackYAML, known, launchApps map[string]bool) {
+	checkEnv := func(field, env string) {
+		if !known[env] {
+			lint.errorf("%s: %s names unknown environment %q, expected one of %s", path, field, env, strings.Join(sortedKeys(known), ", "))
+		}
+	}
+
+	for _, env := range stack.AutoDeployEnvs {
+		checkEnv("autoDeployEnvs", env)
+	}
+	for i, r := range stack.DeployRules {
+		if err := r.validate(); err != nil {
+			lint.errorf("%s: deployRules[%d]: %v", path, i, err)
+		}
+		for _, env := range r.Environments {
+			checkEnv(fmt.Sprintf("deployRules[%d].environments", i), env)
+		}
+	}
+	if stack.Catapult != nil && stack.Catapult.Environment != "" {
+		checkEnv("catapult.environment", stack.Catapult.Environment)
+	}
+	for _, env := range sortedKeys(stack.Overrides) {
+		checkEnv("overrides", env)
+		if err := stack.Overrides[env].validate(); err != nil {
+			lint.errorf("%s: overrides.%s: %v", path, env, err)
+		}
+	}
+	for _, dep := range stack.DeployAfter {
+		switch {
+		case dep == app:
+			lint.errorf("%s: deployAfter: %s cannot be deployed after itself", path, app)
+		case !launchApps[dep]:
+			lint.errorf("%s: deployAfter: %s is not an application in this repo", path, dep)
+		}
+	}
+}
+
+// appNames returns the app name of each file matching pattern, which has
+// a single * in place of the app name.
+func appNames(pattern string) (map[string]bool, error) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	prefix, suffix, _ := strings.Cut(pattern, "*")
+	apps := map[string]bool{}
+	for _, f := range files {
+		if info, err := os.Stat(f); err == nil && info.Mode().IsRegular() {
+			apps[strings.TrimSuffix(strings.TrimPrefix(filepath.ToSlash(f), prefix), suffix)] = true
+		}
+	}
+	return apps, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
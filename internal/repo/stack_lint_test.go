@@ -0,0 +1,49 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLintStacks(t *testing.T) {
+	t.Chdir(t.TempDir())
+	files := map[string]string{
+		"launch/api.yml":             "",
+		"launch/worker.yml":          "",
+		"launch/cron.yml":            "",
+		"config/api/stack.yaml":      "autoDeployEnvs: [clever-dev, prod]\ndeployAfter: [worker]\n",
+		"config/worker/stack.yaml":   "autoDeployEnv: [clever-dev]\n",
+		"config/old-app/stack.yaml":  "deployRules:\n  - branch: master\n    environments: [production]\n",
+		"config/README.md":           "not a stack config",
+		"config/shared/values.yaml":  "ignored: true\n",
+		"config/api/other.yaml":      "ignored: true\n",
+		"launch/not-an-app/foo.yaml": "",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lint, err := LintStacks([]string{"clever-dev", "production"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantErrors := []string{
+		`config/api/stack.yaml: autoDeployEnvs names unknown environment "prod", expected one of clever-dev, production`,
+		"config/old-app/stack.yaml: no launch config launch/old-app.yml for app old-app",
+		`failed to unmarshal stack.yaml for config/worker/stack.yaml: error unmarshaling JSON: while decoding JSON: json: unknown field "autoDeployEnv"`,
+	}
+	if !reflect.DeepEqual(lint.Errors, wantErrors) {
+		t.Errorf("expected errors\n%q\ngot\n%q", wantErrors, lint.Errors)
+	}
+	wantWarnings := []string{"launch/cron.yml: app cron has no stack config config/cron/stack.yaml"}
+	if !reflect.DeepEqual(lint.Warnings, wantWarnings) {
+		t.Errorf("expected warnings %q, got %q", wantWarnings, lint.Warnings)
+	}
+}
@@ -0,0 +1,188 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// IdempotencyKeyHeader is the header the idempotency key of a request is
+// sent in, allowing the server to recognize retries of the same request.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// Policy is an exponential backoff retry policy with full jitter.
+type Policy struct {
+	// InitialInterval is the maximum wait before the first retry. The
+	// maximum wait doubles with each retry up to MaxInterval.
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	// MaxElapsedTime is the total time after which no more retries are
+	// attempted.
+	MaxElapsedTime time.Duration
+	// AttemptTimeout bounds a single attempt, from sending the request
+	// until the response body is closed.
+	AttemptTimeout time.Duration
+}
+
+// NewPolicy returns a policy with sensible defaults which stops retrying
+// after maxElapsed.
+func NewPolicy(maxElapsed time.Duration) Policy {
+	return Policy{
+		InitialInterval: 500 * time.Millisecond,
+		MaxInterval:     15 * time.Second,
+		MaxElapsedTime:  maxElapsed,
+		AttemptTimeout:  15 * time.Second,
+	}
+}
+
+// Backoff returns how long to wait before retrying after the given
+// number of failed attempts. The wait is chosen uniformly between zero
+// and the exponential backoff interval so that concurrent clients do
+// not retry in lockstep.
+func (p Policy) Backoff(attempt int) time.Duration {
+	interval := p.InitialInterval
+	for i := 1; i < attempt && interval < p.MaxInterval; i++ {
+		interval *= 2
+	}
+	interval = min(interval, p.MaxInterval)
+	if interval <= 0 {
+		return 0
+	}
+	return rand.N(interval)
+}
+
+// Timeout is the longest a request made with the policy may take across
+// all of its attempts.
+func (p Policy) Timeout() time.Duration {
+	return p.MaxElapsedTime + p.AttemptTimeout
+}
+
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey returns a context which causes requests made with
+// it through a Transport to carry the idempotency key.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// Transport is an http.RoundTripper which retries requests failing with
+// a transport error, a 429 or a 5xx response according to its policy.
+// Any other response is returned to the caller as is.
+type Transport struct {
+	Policy Policy
+	// Base is the transport which sends each attempt. It defaults to
+	// http.DefaultTransport.
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx := r.Context()
+	if key, ok := ctx.Value(idempotencyKeyCtx{}).(string); ok && key != "" {
+		r = r.Clone(ctx)
+		r.Header.Set(IdempotencyKeyHeader, key)
+	}
+
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		req, err := rewind(r, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, t.Policy.AttemptTimeout)
+		resp, err := t.base().RoundTrip(req.WithContext(attemptCtx))
+
+		wait := t.Policy.Backoff(attempt)
+		if after, ok := retryAfter(resp); ok {
+			wait = after
+		}
+		canRetry := ctx.Err() == nil && retryable(resp, err) &&
+			time.Since(start)+wait <= t.Policy.MaxElapsedTime &&
+			(r.Body == nil || r.GetBody != nil)
+		if !canRetry {
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		}
+
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		cancel()
+		fmt.Printf("%s %s attempt %d failed (%s), retrying in %s\n", r.Method, r.URL.Path, attempt, reason, wait.Round(time.Millisecond))
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// rewind returns a copy of the request with a fresh body for any attempt
+// after the first.
+func rewind(r *http.Request, attempt int) (*http.Request, error) {
+	if attempt == 1 || r.Body == nil || r.GetBody == nil {
+		return r, nil
+	}
+	body, err := r.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("failed to rewind request body for retry: %v", err)
+	}
+	req := r.Clone(r.Context())
+	req.Body = body
+	return req, nil
+}
+
+// retryable returns true for transport errors, throttling and server
+// errors.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// retryAfter parses the number of seconds in a Retry-After header.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+	return time.Duration(secs) * time.Second, true
+}
+
+// cancelBody releases the attempt context once the caller is done with
+// the response body.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
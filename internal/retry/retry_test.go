@@ -0,0 +1,110 @@
+package retry
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testPolicy() Policy {
+	return Policy{
+		InitialInterval: time.Millisecond,
+		MaxInterval:     5 * time.Millisecond,
+		MaxElapsedTime:  time.Second,
+		AttemptTimeout:  time.Second,
+	}
+}
+
+func TestTransportRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantStatus   int
+		wantAttempts int32
+	}{
+		{name: "success", statuses: []int{200}, wantStatus: 200, wantAttempts: 1},
+		{name: "retries 502", statuses: []int{502, 502, 200}, wantStatus: 200, wantAttempts: 3},
+		{name: "retries 429", statuses: []int{429, 200}, wantStatus: 200, wantAttempts: 2},
+		{name: "does not retry 400", statuses: []int{400, 200}, wantStatus: 400, wantAttempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&attempts, 1)
+				body, _ := io.ReadAll(r.Body)
+				if string(body) != "payload" {
+					t.Errorf("attempt %d: expected body to be resent, got %q", n, body)
+				}
+				w.WriteHeader(tt.statuses[n-1])
+			}))
+			defer srv.Close()
+
+			cli := &http.Client{Transport: &Transport{Policy: testPolicy()}}
+			resp, err := cli.Post(srv.URL, "text/plain", strings.NewReader("payload"))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("expected %d attempts, got %d", tt.wantAttempts, attempts)
+			}
+		})
+	}
+}
+
+func TestTransportGivesUpAfterMaxElapsedTime(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	p := testPolicy()
+	p.MaxElapsedTime = 20 * time.Millisecond
+	cli := &http.Client{Transport: &Transport{Policy: p}}
+	resp, err := cli.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("expected the last 502 to be returned, got %d", resp.StatusCode)
+	}
+	if attempts < 2 {
+		t.Errorf("expected multiple attempts, got %d", attempts)
+	}
+}
+
+func TestTransportIdempotencyKey(t *testing.T) {
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(IdempotencyKeyHeader))
+		if len(keys) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	req, _ := http.NewRequestWithContext(WithIdempotencyKey(t.Context(), "repo/app/42"), http.MethodPost, srv.URL, strings.NewReader("{}"))
+	resp, err := (&http.Client{Transport: &Transport{Policy: testPolicy()}}).Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	if len(keys) != 2 || keys[0] != "repo/app/42" || keys[1] != "repo/app/42" {
+		t.Errorf("expected the idempotency key on every attempt, got %v", keys)
+	}
+}
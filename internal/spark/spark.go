@@ -0,0 +1,92 @@
+package spark
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Clever/ci-scripts/internal/environment"
+)
+
+// uploadConcurrency is the number of files uploaded at once.
+const uploadConcurrency = 8
+
+// Spark wraps s3 to provide a simple API for publishing spark jobs.
+type Spark struct {
+	awsCfg aws.Config
+}
+
+// New initializes a new Spark handling wrapper with it's aws config.
+func New(ctx context.Context) *Spark {
+	cfg := environment.AWSCfg(ctx, environment.OidcGlueUploadRole())
+	cfg.Region = glueRegion
+	return &Spark{awsCfg: cfg}
+}
+
+// Publish an already built spark job directory to s3. Every file in the
+// directory, including the job script and any library jars or zips, is
+// uploaded under the <artifact>/<short sha>/ prefix with its path
+// relative to the directory preserved.
+func (s *Spark) Publish(ctx context.Context, dir, artifactName string) error {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to read spark job directory %s: %v", dir, err)
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("spark job directory %s is empty", dir)
+	}
+
+	var (
+		bucket   = bucket()
+		prefix   = s3Prefix(artifactName)
+		uploader = manager.NewUploader(s3.NewFromConfig(s.awsCfg))
+	)
+	fmt.Println("uploading spark job", dir, "to", fmt.Sprintf("s3://%s/%s", bucket, prefix), "...")
+
+	grp, grpCtx := errgroup.WithContext(ctx)
+	grp.SetLimit(uploadConcurrency)
+	for _, file := range files {
+		grp.Go(func() error {
+			rel, err := filepath.Rel(dir, file)
+			if err != nil {
+				return err
+			}
+			key := path.Join(prefix, filepath.ToSlash(rel))
+
+			f, err := os.Open(file)
+			if err != nil {
+				return fmt.Errorf("unable to open spark job file %s: %v", file, err)
+			}
+			defer f.Close()
+
+			_, err = uploader.Upload(grpCtx, &s3.PutObjectInput{
+				Bucket: aws.String(bucket),
+				Key:    aws.String(key),
+				Body:   f,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to upload %s to s3://%s/%s: %v", file, bucket, key, err)
+			}
+			return nil
+		})
+	}
+
+	return grp.Wait()
+}
@@ -0,0 +1,79 @@
+package spark
+
+import (
+	"fmt"
+
+	"github.com/Clever/catapult/gen-go/models"
+	"github.com/Clever/ci-scripts/internal/catapult"
+	"github.com/Clever/ci-scripts/internal/environment"
+	"github.com/Clever/ci-scripts/internal/repo"
+)
+
+// glueRegion is the only region spark jobs are run in.
+const glueRegion = "us-west-2"
+
+// SparkTarget represents the information needed to build and publish a
+// spark job to S3.
+type SparkTarget struct {
+	// Dir is the path to the directory holding the job script and any
+	// library jars or zips on the local FS.
+	Dir string
+	// Command is the command to run to build the spark job.
+	Command string
+}
+
+// BuildTargets returns a set of spark targets to build and publish to
+// S3 as well as a list of artifacts to be published to catapult. The
+// targets map has the artifact name as the key. Any apps with a shared
+// artifact will have only one entry in the map, but will still have
+// individual entries in the catapult build artifacts.
+func BuildTargets(apps map[string]*models.LaunchConfig) (map[string]SparkTarget, []*catapult.Artifact) {
+	var (
+		targets   = map[string]SparkTarget{}
+		done      = map[string]struct{}{}
+		artifacts []*catapult.Artifact
+	)
+
+	for name, launch := range apps {
+		if !repo.IsSparkRunType(launch) {
+			continue
+		}
+
+		artifact := repo.ArtifactName(name, launch)
+		artifacts = append(artifacts, &catapult.Artifact{
+			RunType:   string(repo.RunTypeSpark),
+			ID:        name,
+			Branch:    environment.Branch(),
+			Source:    fmt.Sprintf("github:Clever/%s@%s", environment.Repo(), environment.FullSHA1()),
+			Artifacts: fmt.Sprintf("spark:clever/%s@%s;S3Key=\"%s,S3Buckets={%s=\"%s", artifact, environment.ShortSHA1(), s3Prefix(artifact), glueRegion, bucket()),
+		})
+
+		if _, ok := done[artifact]; ok {
+			fmt.Println(name, "shares artifact with", artifact)
+			continue
+		}
+		done[artifact] = struct{}{}
+		targets[artifact] = SparkTarget{
+			Dir:     fmt.Sprintf("./bin/%s", artifact),
+			Command: repo.BuildCommand(launch),
+		}
+	}
+	return targets, artifacts
+}
+
+// s3Prefix is the key prefix the contents of the spark job directory
+// are uploaded under. This matches the layout of the
+// catapult-publish-spark script.
+func s3Prefix(artifactName string) string {
+	return fmt.Sprintf("%s/%s", artifactName, environment.ShortSHA1())
+}
+
+// ArtifactURI returns the S3 URI the spark job directory of the artifact
+// is uploaded under.
+func ArtifactURI(artifactName string) string {
+	return fmt.Sprintf("s3://%s/%s", bucket(), s3Prefix(artifactName))
+}
+
+func bucket() string {
+	return fmt.Sprintf("%s-%s", environment.GlueArtifactBucketPrefix(), glueRegion)
+}
@@ -0,0 +1,65 @@
+package spark
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/Clever/catapult/gen-go/models"
+	"github.com/Clever/ci-scripts/internal/catapult"
+)
+
+func TestBuildTargets(t *testing.T) {
+	t.Setenv("CIRCLE_PROJECT_REPONAME", "my-repo")
+	t.Setenv("CIRCLE_SHA1", "abc1234def5678")
+	t.Setenv("CIRCLE_BRANCH", "master")
+	t.Setenv("GLUE_AWS_BUCKET", "clever-glue")
+
+	apps := map[string]*models.LaunchConfig{}
+	for name, launch := range map[string]string{
+		"etl":        `{"run": {"type": "spark"}, "build": {"artifact": {"command": "make etl"}}}`,
+		"report":     `{"run": {"type": "spark"}, "build": {"artifact": {"name": "reports", "command": "make reports"}}}`,
+		"report-sso": `{"run": {"type": "spark"}, "build": {"artifact": {"name": "reports", "command": "make reports"}}}`,
+		"api":        `{"run": {"type": "docker"}}`,
+	} {
+		var lc models.LaunchConfig
+		if err := json.Unmarshal([]byte(launch), &lc); err != nil {
+			t.Fatal(err)
+		}
+		apps[name] = &lc
+	}
+
+	targets, artifacts := BuildTargets(apps)
+
+	wantTargets := map[string]SparkTarget{
+		"etl":     {Dir: "./bin/etl", Command: "make etl"},
+		"reports": {Dir: "./bin/reports", Command: "make reports"},
+	}
+	if !reflect.DeepEqual(targets, wantTargets) {
+		t.Errorf("expected targets %+v, got %+v", wantTargets, targets)
+	}
+
+	// Apps sharing an artifact each have their own catapult artifact.
+	sort.Slice(artifacts, func(i, j int) bool { return artifacts[i].ID < artifacts[j].ID })
+	source := "github:Clever/my-repo@abc1234def5678"
+	wantArtifacts := []*catapult.Artifact{
+		{RunType: "spark", ID: "etl", Branch: "master", Source: source, Artifacts: `spark:clever/etl@abc1234;S3Key="etl/abc1234,S3Buckets={us-west-2="clever-glue-us-west-2`},
+		{RunType: "spark", ID: "report", Branch: "master", Source: source, Artifacts: `spark:clever/reports@abc1234;S3Key="reports/abc1234,S3Buckets={us-west-2="clever-glue-us-west-2`},
+		{RunType: "spark", ID: "report-sso", Branch: "master", Source: source, Artifacts: `spark:clever/reports@abc1234;S3Key="reports/abc1234,S3Buckets={us-west-2="clever-glue-us-west-2`},
+	}
+	if !reflect.DeepEqual(artifacts, wantArtifacts) {
+		t.Errorf("expected artifacts %+v, got %+v", wantArtifacts, artifacts)
+	}
+}
+
+func TestArtifactURI(t *testing.T) {
+	t.Setenv("CIRCLE_SHA1", "abc1234def5678")
+	t.Setenv("GLUE_AWS_BUCKET", "clever-glue")
+
+	// catapult-publish-spark uploads jobs to
+	// s3://<GLUE_AWS_BUCKET>-us-west-2/<artifact>/<short sha>.
+	if got, want := ArtifactURI("reports"), "s3://clever-glue-us-west-2/reports/abc1234"; got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,248 @@
+package static
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/andybalholm/brotli"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Clever/ci-scripts/internal/environment"
+)
+
+// deleteBatchSize is the maximum number of keys S3 accepts in a single
+// DeleteObjects request.
+const deleteBatchSize = 1000
+
+// Static wraps s3 to provide a simple API for uploading static file
+// bundles.
+type Static struct {
+	awsCfg aws.Config
+}
+
+// New initializes a new Static handling wrapper with it's aws config.
+func New(ctx context.Context) *Static {
+	return &Static{
+		awsCfg: environment.AWSCfg(ctx, environment.OidcS3UploadRole()),
+	}
+}
+
+// Publish uploads every file in the target's source directory to its
+// bucket and prefix, compressing and setting headers on each file
+// according to the target's rules. Files are uploaded by a pool of
+// t.Workers goroutines. If DeleteStale is set, any other objects under
+// the prefix are deleted once all uploads succeed.
+func (s *Static) Publish(ctx context.Context, t StaticTarget) error {
+	var files []string
+	err := filepath.WalkDir(t.Source, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to read static files in %s: %v", t.Source, err)
+	}
+
+	cfg := s.awsCfg.Copy()
+	cfg.Region = t.Region
+	client := s3.NewFromConfig(cfg)
+	uploader := manager.NewUploader(client)
+
+	fmt.Println("uploading", len(files), "static files from", t.Source, "to", fmt.Sprintf("s3://%s/%s", t.Bucket, t.Prefix), "...")
+
+	var (
+		uploaded = make([]string, len(files))
+		bytesOut int64
+	)
+	grp, grpCtx := errgroup.WithContext(ctx)
+	grp.SetLimit(t.Workers)
+	for i, file := range files {
+		grp.Go(func() error {
+			rel, err := filepath.Rel(t.Source, file)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			key := path.Join(t.Prefix, rel)
+
+			in, size, err := t.putObjectInput(file, rel)
+			if err != nil {
+				return err
+			}
+			in.Bucket = aws.String(t.Bucket)
+			in.Key = aws.String(key)
+
+			if _, err := uploader.Upload(grpCtx, in); err != nil {
+				return fmt.Errorf("failed to upload %s to s3://%s/%s: %v", file, t.Bucket, key, err)
+			}
+			uploaded[i] = key
+			atomic.AddInt64(&bytesOut, size)
+			return nil
+		})
+	}
+	if err := grp.Wait(); err != nil {
+		return err
+	}
+	fmt.Println("uploaded", len(files), "static files,", bytesOut, "bytes")
+
+	if !t.DeleteStale {
+		return nil
+	}
+	return deleteStale(ctx, client, t, uploaded)
+}
+
+// putObjectInput reads the file, applying any configured encoding, and
+// sets its content headers. The returned size is the number of bytes
+// uploaded.
+func (t StaticTarget) putObjectInput(file, rel string) (*s3.PutObjectInput, int64, error) {
+	bs, err := os.ReadFile(file)
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to read static file %s: %v", file, err)
+	}
+
+	ext := strings.ToLower(path.Ext(rel))
+	in := &s3.PutObjectInput{
+		ContentType: aws.String(t.contentType(ext, bs)),
+	}
+	if cc := t.cacheControl(rel); cc != "" {
+		in.CacheControl = aws.String(cc)
+	}
+	if encoding, ok := t.Encodings[ext]; ok {
+		if bs, err = encode(encoding, bs); err != nil {
+			return nil, 0, fmt.Errorf("unable to %s encode %s: %v", encoding, file, err)
+		}
+		in.ContentEncoding = aws.String(encoding)
+	}
+	in.Body = bytes.NewReader(bs)
+	return in, int64(len(bs)), nil
+}
+
+// contentType returns the configured content type for the extension,
+// falling back to the standard mime type for the extension and then to
+// sniffing the content.
+func (t StaticTarget) contentType(ext string, bs []byte) string {
+	if ct, ok := t.ContentTypes[ext]; ok {
+		return ct
+	}
+	if ct := mime.TypeByExtension(ext); ct != "" {
+		return ct
+	}
+	return http.DetectContentType(bs)
+}
+
+// cacheControl returns the value of the first cache control rule which
+// matches the file, or an empty string if none match.
+func (t StaticTarget) cacheControl(rel string) string {
+	for _, rule := range t.CacheControl {
+		name := path.Base(rel)
+		if strings.Contains(rule.Pattern, "/") {
+			name = rel
+		}
+		if ok, _ := path.Match(rule.Pattern, name); ok {
+			return rule.Value
+		}
+	}
+	return ""
+}
+
+func encode(encoding string, bs []byte) ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+	)
+	switch encoding {
+	case encodingGzip:
+		gz, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		w = gz
+	case encodingBrotli:
+		w = brotli.NewWriterLevel(&buf, brotli.BestCompression)
+	default:
+		return nil, fmt.Errorf("unsupported encoding %s", encoding)
+	}
+
+	if _, err := w.Write(bs); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// deleteStale deletes every object under the target prefix which is not
+// one of the uploaded keys.
+func deleteStale(ctx context.Context, client *s3.Client, t StaticTarget, uploaded []string) error {
+	keep := map[string]struct{}{}
+	for _, k := range uploaded {
+		keep[k] = struct{}{}
+	}
+
+	prefix := t.Prefix
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	var stale []types.ObjectIdentifier
+	pages := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(t.Bucket),
+		Prefix: aws.String(prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list s3://%s/%s: %v", t.Bucket, prefix, err)
+		}
+		stale = append(stale, staleObjects(page.Contents, keep)...)
+	}
+
+	for start := 0; start < len(stale); start += deleteBatchSize {
+		end := min(start+deleteBatchSize, len(stale))
+		out, err := client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(t.Bucket),
+			Delete: &types.Delete{Objects: stale[start:end], Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete stale objects from s3://%s/%s: %v", t.Bucket, prefix, err)
+		}
+		if len(out.Errors) > 0 {
+			e := out.Errors[0]
+			return fmt.Errorf("failed to delete %d stale objects from s3://%s/%s, first error on %s: %s",
+				len(out.Errors), t.Bucket, prefix, aws.ToString(e.Key), aws.ToString(e.Message))
+		}
+	}
+	fmt.Println("deleted", len(stale), "stale static files from", fmt.Sprintf("s3://%s/%s", t.Bucket, prefix))
+	return nil
+}
+
+// staleObjects returns the objects which are not one of the kept keys.
+func staleObjects(objects []types.Object, keep map[string]struct{}) []types.ObjectIdentifier {
+	var stale []types.ObjectIdentifier
+	for _, obj := range objects {
+		if _, ok := keep[aws.ToString(obj.Key)]; !ok {
+			stale = append(stale, types.ObjectIdentifier{Key: obj.Key})
+		}
+	}
+	return stale
+}
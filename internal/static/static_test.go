@@ -0,0 +1,77 @@
+package static
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/Clever/ci-scripts/internal/repo"
+)
+
+func TestContentType(t *testing.T) {
+	target := StaticTarget{ContentTypes: map[string]string{".wasm": "application/x-custom-wasm", ".js": "text/javascript; charset=utf-8"}}
+	for _, tc := range []struct {
+		ext  string
+		body string
+		want string
+	}{
+		{ext: ".wasm", want: "application/x-custom-wasm"},
+		{ext: ".js", want: "text/javascript; charset=utf-8"},
+		{ext: ".css", want: "text/css; charset=utf-8"},
+		{ext: "", body: "<html><body></body></html>", want: "text/html; charset=utf-8"},
+		{ext: ".unknownext", body: "plain text", want: "text/plain; charset=utf-8"},
+	} {
+		if got := target.contentType(tc.ext, []byte(tc.body)); got != tc.want {
+			t.Errorf("%q: expected %s, got %s", tc.ext, tc.want, got)
+		}
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	target := StaticTarget{CacheControl: []repo.CacheControlRule{
+		{Pattern: "*.html", Value: "no-cache"},
+		{Pattern: "assets/*", Value: "max-age=31536000, immutable"},
+		{Pattern: "*.js", Value: "max-age=3600"},
+	}}
+	for _, tc := range []struct {
+		rel  string
+		want string
+	}{
+		// Patterns without a / match the file name in any directory.
+		{rel: "index.html", want: "no-cache"},
+		{rel: "docs/index.html", want: "no-cache"},
+		// Patterns with a / match the relative path, and the first
+		// matching rule wins.
+		{rel: "assets/app.js", want: "max-age=31536000, immutable"},
+		{rel: "assets/nested/app.js", want: "max-age=3600"},
+		{rel: "app.js", want: "max-age=3600"},
+		{rel: "favicon.ico", want: ""},
+	} {
+		if got := target.cacheControl(tc.rel); got != tc.want {
+			t.Errorf("%s: expected %q, got %q", tc.rel, tc.want, got)
+		}
+	}
+}
+
+func TestStaleObjects(t *testing.T) {
+	keep := map[string]struct{}{
+		"my-app/index.html": {},
+		"my-app/app.js":     {},
+	}
+	var objects []types.Object
+	for _, key := range []string{"my-app/index.html", "my-app/old.js", "my-app/app.js", "my-app/nested/old.css"} {
+		objects = append(objects, types.Object{Key: aws.String(key)})
+	}
+	var stale []string
+	for _, obj := range staleObjects(objects, keep) {
+		stale = append(stale, aws.ToString(obj.Key))
+	}
+	if got := strings.Join(stale, ","); got != "my-app/old.js,my-app/nested/old.css" {
+		t.Errorf("expected my-app/old.js and my-app/nested/old.css to be stale, got %s", got)
+	}
+	if stale := staleObjects(objects[:1], keep); len(stale) != 0 {
+		t.Errorf("expected nothing stale, got %d objects", len(stale))
+	}
+}
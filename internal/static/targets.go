@@ -0,0 +1,137 @@
+package static
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/Clever/catapult/gen-go/models"
+	"github.com/Clever/ci-scripts/internal/environment"
+	"github.com/Clever/ci-scripts/internal/repo"
+)
+
+const (
+	defaultRegion  = "us-west-2"
+	defaultWorkers = 8
+
+	encodingGzip   = "gzip"
+	encodingBrotli = "br"
+)
+
+// StaticTarget represents the information needed to build and upload a
+// bundle of static files to S3.
+//
+// Static files are produced by the application's build command, which
+// has already run by the time they are uploaded.
+type StaticTarget struct {
+	// Source is the local directory holding the built files.
+	Source string
+	// Bucket, Prefix and Region are the resolved upload destination.
+	Bucket string
+	Prefix string
+	Region string
+	// Encodings maps a file extension to its content encoding.
+	Encodings map[string]string
+	// ContentTypes maps a file extension to its content type.
+	ContentTypes map[string]string
+	// CacheControl rules are evaluated in order for each file.
+	CacheControl []repo.CacheControlRule
+	DeleteStale  bool
+	Workers      int
+}
+
+// BuildTargets returns the static file bundles configured in the launch
+// configs of the apps keyed by app name.
+func BuildTargets(apps map[string]*models.LaunchConfig) (map[string]StaticTarget, error) {
+	targets := map[string]StaticTarget{}
+	for name := range apps {
+		build, err := repo.ExtendedBuildConfig(name)
+		if err != nil {
+			return nil, err
+		}
+		if build.Static == nil {
+			continue
+		}
+		t, err := newTarget(name, build.Static)
+		if err != nil {
+			return nil, fmt.Errorf("invalid static configuration for %s: %v", name, err)
+		}
+		targets[name] = t
+	}
+	return targets, nil
+}
+
+func newTarget(app string, cfg *repo.StaticBuild) (StaticTarget, error) {
+	if cfg.Source == "" {
+		return StaticTarget{}, fmt.Errorf("source is required")
+	}
+	if cfg.Bucket == "" {
+		return StaticTarget{}, fmt.Errorf("bucket is required")
+	}
+
+	t := StaticTarget{
+		Source:       cfg.Source,
+		Bucket:       expand(cfg.Bucket, app),
+		Prefix:       strings.Trim(expand(cfg.Prefix, app), "/"),
+		Region:       cfg.Region,
+		Encodings:    map[string]string{},
+		ContentTypes: map[string]string{},
+		CacheControl: cfg.CacheControl,
+		DeleteStale:  cfg.DeleteStale,
+		Workers:      cfg.Workers,
+	}
+	if t.DeleteStale && t.Prefix == "" {
+		return StaticTarget{}, fmt.Errorf("deleteStale requires a prefix, or it would delete every other object in the bucket")
+	}
+	if t.Region == "" {
+		t.Region = defaultRegion
+	}
+	if t.Workers <= 0 {
+		t.Workers = defaultWorkers
+	}
+
+	for encoding, exts := range cfg.Encodings {
+		if encoding != encodingGzip && encoding != encodingBrotli {
+			return StaticTarget{}, fmt.Errorf("unsupported encoding %s, expected %s or %s", encoding, encodingGzip, encodingBrotli)
+		}
+		for _, ext := range exts {
+			ext = normalizeExt(ext)
+			if other, ok := t.Encodings[ext]; ok {
+				return StaticTarget{}, fmt.Errorf("extension %s is configured for both %s and %s", ext, other, encoding)
+			}
+			t.Encodings[ext] = encoding
+		}
+	}
+	for ext, contentType := range cfg.ContentTypes {
+		t.ContentTypes[normalizeExt(ext)] = contentType
+	}
+	for _, rule := range cfg.CacheControl {
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return StaticTarget{}, fmt.Errorf("invalid cache control pattern %q: %v", rule.Pattern, err)
+		}
+	}
+	return t, nil
+}
+
+// expand replaces the build placeholders in a bucket or prefix
+// template.
+func expand(tmpl, app string) string {
+	if !strings.Contains(tmpl, "{") {
+		return tmpl
+	}
+	return strings.NewReplacer(
+		"{app}", app,
+		"{repo}", environment.Repo(),
+		"{branch}", environment.Branch(),
+		"{sha}", environment.ShortSHA1(),
+		"{fullsha}", environment.FullSHA1(),
+	).Replace(tmpl)
+}
+
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
@@ -0,0 +1,116 @@
+package static
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Clever/ci-scripts/internal/repo"
+)
+
+func TestNewTarget(t *testing.T) {
+	t.Setenv("CIRCLE_PROJECT_REPONAME", "my-repo")
+	t.Setenv("CIRCLE_BRANCH", "master")
+	t.Setenv("CIRCLE_SHA1", "abc1234def5678")
+
+	for _, tc := range []struct {
+		name    string
+		cfg     repo.StaticBuild
+		want    StaticTarget
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			cfg:  repo.StaticBuild{Source: "./dist", Bucket: "assets"},
+			want: StaticTarget{Source: "./dist", Bucket: "assets", Region: defaultRegion, Workers: defaultWorkers},
+		},
+		{
+			name: "placeholders and normalized extensions",
+			cfg: repo.StaticBuild{
+				Source:       "./dist",
+				Bucket:       "{repo}-assets",
+				Prefix:       "/{app}/{sha}/",
+				Region:       "us-east-1",
+				Encodings:    map[string][]string{"br": {"JS", ".css"}, "gzip": {".html"}},
+				ContentTypes: map[string]string{"wasm": "application/wasm"},
+				DeleteStale:  true,
+				Workers:      2,
+			},
+			want: StaticTarget{
+				Source:       "./dist",
+				Bucket:       "my-repo-assets",
+				Prefix:       "my-app/abc1234",
+				Region:       "us-east-1",
+				Encodings:    map[string]string{".js": "br", ".css": "br", ".html": "gzip"},
+				ContentTypes: map[string]string{".wasm": "application/wasm"},
+				DeleteStale:  true,
+				Workers:      2,
+			},
+		},
+		{
+			name:    "missing source",
+			cfg:     repo.StaticBuild{Bucket: "assets"},
+			wantErr: "source is required",
+		},
+		{
+			name:    "missing bucket",
+			cfg:     repo.StaticBuild{Source: "./dist"},
+			wantErr: "bucket is required",
+		},
+		{
+			name:    "delete stale without a prefix",
+			cfg:     repo.StaticBuild{Source: "./dist", Bucket: "assets", DeleteStale: true},
+			wantErr: "deleteStale requires a prefix",
+		},
+		{
+			name:    "delete stale with a root prefix",
+			cfg:     repo.StaticBuild{Source: "./dist", Bucket: "assets", Prefix: "//", DeleteStale: true},
+			wantErr: "deleteStale requires a prefix",
+		},
+		{
+			name:    "unsupported encoding",
+			cfg:     repo.StaticBuild{Source: "./dist", Bucket: "assets", Encodings: map[string][]string{"zstd": {".js"}}},
+			wantErr: "unsupported encoding zstd",
+		},
+		{
+			name:    "extension with two encodings",
+			cfg:     repo.StaticBuild{Source: "./dist", Bucket: "assets", Encodings: map[string][]string{"br": {".js"}, "gzip": {"js"}}},
+			wantErr: "extension .js is configured for both",
+		},
+		{
+			name:    "invalid cache control pattern",
+			cfg:     repo.StaticBuild{Source: "./dist", Bucket: "assets", CacheControl: []repo.CacheControlRule{{Pattern: "[", Value: "no-cache"}}},
+			wantErr: `invalid cache control pattern "["`,
+		},
+	} {
+		got, err := newTarget("my-app", &tc.cfg)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%s: expected error %q, got %v", tc.name, tc.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.name, err)
+			continue
+		}
+		if got.Source != tc.want.Source || got.Bucket != tc.want.Bucket || got.Prefix != tc.want.Prefix ||
+			got.Region != tc.want.Region || got.DeleteStale != tc.want.DeleteStale || got.Workers != tc.want.Workers {
+			t.Errorf("%s: expected %+v, got %+v", tc.name, tc.want, got)
+		}
+		if !equalMaps(got.Encodings, tc.want.Encodings) || !equalMaps(got.ContentTypes, tc.want.ContentTypes) {
+			t.Errorf("%s: expected encodings %v and content types %v, got %v and %v", tc.name, tc.want.Encodings, tc.want.ContentTypes, got.Encodings, got.ContentTypes)
+		}
+	}
+}
+
+func equalMaps(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}